@@ -2,7 +2,10 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
@@ -11,11 +14,16 @@ import (
 	"log"
 	"math"
 	"net/http"
+	"os"
+	"strconv"
 	"sync"
 	"time"
 
 	////"golang.org/x/image/font/basicfont"
 	"dev/pkg/i2c"
+	"dev/pkg/i2c/netbus"
+	"dev/pkg/probe"
+	"dev/pkg/psychrometrics"
 	"dev/pkg/sht31"
 	"dev/pkg/ssh1107"
 
@@ -26,6 +34,9 @@ import (
 
 const shellyURL string = "http://192.168.1.126/rpc"
 
+// defaultAdapter is the name of the Pico running the i2c-tiny-usb firmware
+const defaultAdapter string = "i2c-tiny-usb"
+
 var (
 	displayBuffer = make([]byte, 2048)
 	mu            sync.Mutex
@@ -328,6 +339,106 @@ func (ss *ShellyScreen) Update() {
 	copy(displayBuffer, buffer)
 }
 
+// ==============================================================================
+type SensorScreen struct {
+	display ssh1107.Display
+	sensor  *sht31.SHT31
+	values  psychrometrics.Values
+	err     error
+	mu      *sync.RWMutex
+}
+
+func (ss *SensorScreen) Draw() {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	img := ss.display.GetImage()
+	ss.display.ClearImage(color.RGBA{0, 0, 0, 0})
+
+	drawer := &font.Drawer{
+		Dst:  img,
+		Src:  &image.Uniform{color.White},
+		Face: inconsolata.Bold8x16,
+		Dot:  fixed.Point26_6{X: fixed.Int26_6(8 * 64), Y: fixed.Int26_6(16 * 64)},
+	}
+	drawer.DrawString("SHT31")
+
+	lines := []string{"Read failed"}
+	if ss.err == nil {
+		v := ss.values
+		// At most 15 characters of 8 px fit past the 8 px margin
+		lines = []string{
+			fmt.Sprintf("Temp %5.1f °C", v.Temperature),
+			fmt.Sprintf("RH   %5.1f %%", v.Humidity),
+			fmt.Sprintf("Dew  %5.1f °C", v.DewPoint),
+			fmt.Sprintf("AH   %5.1f g/m3", v.AbsoluteHumidity),
+			fmt.Sprintf("Heat %5.1f °C", v.HeatIndex),
+		}
+	}
+	drawer.Face = inconsolata.Regular8x16
+	for i, line := range lines {
+		drawer.Dot = fixed.Point26_6{
+			X: fixed.Int26_6(8 * 64),
+			Y: fixed.Int26_6((40 + 18*i) * 64),
+		}
+		drawer.DrawString(line)
+	}
+
+	ss.display.Draw()
+	ss.display.Display_old()
+	ss.display.DisplayOn()
+}
+
+func (ss *SensorScreen) Update() {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	buffer := ss.display.GetBuffer()
+	mu.Lock()
+	defer mu.Unlock()
+	copy(displayBuffer, buffer)
+}
+
+// poll reads the sensor every interval, on its own goroutine so that the
+// reads go ahead of the frame pushes instead of waiting for them
+func (ss *SensorScreen) poll(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		temp, hum, err := ss.sensor.MeasureContext(ctx)
+		cancel()
+
+		ss.mu.Lock()
+		ss.err = err
+		if err != nil {
+			fmt.Println("SHT31 read failed:", err)
+		} else {
+			ss.values = psychrometrics.Compute(temp, hum)
+		}
+		ss.mu.Unlock()
+	}
+}
+
+// serveSensor publishes the last SHT31 reading with its derived values
+func (ss *SensorScreen) serveSensor(w http.ResponseWriter, r *http.Request) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	if ss.err != nil {
+		http.Error(w, ss.err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	// Encoded before anything is sent, so that an error is still reported
+	data, err := json.Marshal(ss.values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
 //==============================================================================
 
 type Screen interface {
@@ -388,43 +499,236 @@ func serveBuffer(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(array)
 }
 
+// serveStats publishes the I2C traffic statistics of each device
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(i2c.Stats())
+}
+
 func serveHTML(w http.ResponseWriter, r *http.Request) {
 	http.ServeFile(w, r, "oled.html")
 }
 
+// ==============================================================================
+// openBus finds the adapter given by bus number, adapter name or USB path
+func openBus(id string) (i2c.Adapter, error) {
+	if num, err := strconv.Atoi(id); err == nil {
+		return i2c.Adapter{Number: num}, nil
+	}
+	info, err := i2c.FindAdapter(i2c.SysfsRoot, id)
+	if err != nil {
+		return i2c.Adapter{}, err
+	}
+	fmt.Printf("Using %s (i2c-%d)\n", info.Name, info.Number)
+	return i2c.Adapter{Number: info.Number}, nil
+}
+
+// detect scans a bus and prints the devices found, like i2cdetect
+func detect(args []string) {
+	fs := flag.NewFlagSet("detect", flag.ExitOnError)
+	adapter := fs.String("adapter", defaultAdapter, "I2C bus number, adapter name or USB path")
+	fs.Parse(args)
+
+	bus, err := openBus(*adapter)
+	if err != nil {
+		log.Fatalf("Failed to find I2C adapter: %v", err)
+	}
+	found, err := i2c.Scan(bus)
+	if err != nil {
+		log.Fatalf("Scan of bus %d failed: %v", bus.Number, err)
+	}
+	i2c.PrintGrid(os.Stdout, found)
+}
+
+// identify scans a bus, prints the chips recognized and reads the sensors
+func identify(args []string) {
+	fs := flag.NewFlagSet("identify", flag.ExitOnError)
+	adapter := fs.String("adapter", defaultAdapter, "I2C bus number, adapter name or USB path")
+	fs.Parse(args)
+
+	bus, err := openBus(*adapter)
+	if err != nil {
+		log.Fatalf("Failed to find I2C adapter: %v", err)
+	}
+	found, err := i2c.Scan(bus)
+	if err != nil {
+		log.Fatalf("Scan of bus %d failed: %v", bus.Number, err)
+	}
+	ids := probe.Identify(bus, found)
+	for _, id := range ids {
+		fmt.Println(id)
+	}
+
+	drivers, err := probe.New(bus, ids)
+	if err != nil {
+		log.Fatalf("Failed to create drivers: %v", err)
+	}
+	for _, drv := range drivers {
+		if sensor, ok := drv.Device.(*sht31.SHT31); ok {
+			temp, hum, err := sensor.MeasureContext(context.Background())
+			if err != nil {
+				fmt.Printf("%#02x: read failed: %v\n", drv.Addr, err)
+			} else {
+				fmt.Printf("%#02x: %.2f °C, %.2f %%\n", drv.Addr, temp, hum)
+			}
+		}
+		drv.Conn.Close()
+	}
+}
+
+// serve exports the bus over TCP, for the devices to be driven with -remote
+// from another machine
+func serve(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	adapter := fs.String("adapter", defaultAdapter, "I2C bus number, adapter name or USB path")
+	listen := fs.String("listen", "127.0.0.1:7070", "TCP address to listen on, anyone reaching it gets raw access to the bus")
+	fs.Parse(args)
+
+	bus, err := openBus(*adapter)
+	if err != nil {
+		log.Fatalf("Failed to find I2C adapter: %v", err)
+	}
+	fmt.Printf("Serving i2c-%d on %s\n", bus.Number, *listen)
+	log.Fatal(netbus.NewServer(bus).ListenAndServe(*listen))
+}
+
+// openDevice opens addr on bus. Devices of a local adapter are opened behind
+// a Reconnector when reconnect is set, remote ones are opened as is.
+func openDevice(bus i2c.Bus, reconnect bool, addr uint16) (i2c.Conn, error) {
+	if !reconnect {
+		return bus.Open(addr)
+	}
+	return i2c.OpenReconnecting(bus, addr)
+}
+
+// onReconnect registers hook on conn if it reconnects after an unplug
+func onReconnect(conn i2c.Conn, hook func(conn i2c.Conn) error) {
+	if r, ok := conn.(*i2c.Reconnector); ok {
+		r.OnReconnect(hook)
+	}
+}
+
 // ==============================================================================
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "detect":
+			detect(os.Args[2:])
+			return
+		case "identify":
+			identify(os.Args[2:])
+			return
+		case "serve":
+			serve(os.Args[2:])
+			return
+		}
+	}
+
+	adapter := flag.String("adapter", defaultAdapter, "I2C bus number, adapter name or USB path")
+	remote := flag.String("remote", "", "Use the bus exported by 'serve' at this host:port instead of a local adapter")
+	trace := flag.String("trace", "", "Log every I2C transaction to this JSON Lines file")
+	lockWait := flag.Duration("lock-wait", 0, "How long to wait for devices used by another instance, forever when negative")
+	i2cTimeout := flag.Duration("i2c-timeout", time.Second, "How long the adapter waits for a transfer to complete, adapter default when zero")
+	i2cRetries := flag.Int("i2c-retries", 0, "How many times the adapter retries a transfer that lost arbitration, adapter default when zero")
+	flag.Parse()
+
 	fmt.Println("### init server... ")
 	http.HandleFunc("/", serveHTML)
 	http.HandleFunc("/buffer", serveBuffer)
+	http.HandleFunc("/stats", serveStats)
 	go http.ListenAndServe(":8088", nil)
 
+	var bus i2c.Bus
+	var reconnect bool
+	if *remote != "" {
+		client, err := netbus.Dial(*remote)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %v", *remote, err)
+		}
+		defer client.Close()
+		bus = client
+	} else {
+		adapterBus, err := openBus(*adapter)
+		if err != nil {
+			log.Fatalf("Failed to find I2C adapter: %v", err)
+		}
+		adapterBus.Options.LockWait = *lockWait
+		adapterBus.Options.Timeout = *i2cTimeout
+		adapterBus.Options.Retries = *i2cRetries
+		// The adapter is looked up again when it comes back after an
+		// unplug, its number may have changed
+		if named, err := adapterBus.Named(); err != nil {
+			fmt.Println("Reconnection disabled:", err)
+			bus = adapterBus
+		} else {
+			bus, reconnect = named, true
+		}
+	}
+	if *trace != "" {
+		traceFile, err := os.Create(*trace)
+		if err != nil {
+			log.Fatalf("Failed to create trace file: %v", err)
+		}
+		defer traceFile.Close()
+		bus = i2c.NewTraceLog(traceFile).WrapBus(bus)
+	}
+
 	// Initialize I2C SHT31 device
-	sht31_dev, err := i2c.Init(9, 0x44) // bus 1, address 0x3c
+	sht31_dev, err := openDevice(bus, reconnect, sht31.SHT31DefaultAddr)
 	if err != nil {
 		log.Fatalf("Failed to initialize I2C device: %v", err)
 	}
 	defer sht31_dev.Close()
 	// Initialize I2C sh1107 device
-	ssh1107_dev, err := i2c.Init(9, 0x3c) // bus 1, address 0x3c
+	ssh1107_dev, err := openDevice(bus, reconnect, 0x3c)
 	if err != nil {
 		log.Fatalf("Failed to initialize I2C device: %v", err)
 	}
 	defer ssh1107_dev.Close()
 
-	sensor := sht31.NewSHT31(sht31_dev)
+	// Both devices share the adapter: sensor reads go ahead of frame pushes
+	sched := i2c.NewScheduler()
+	sensor, err := sht31.NewSHT31(sched.Wrap(sht31_dev, i2c.PriorityHigh))
+	if err != nil {
+		log.Fatalf("SHT31 init failed: %v", err)
+	}
+	if serial, err := sensor.ReadSerial(); err != nil {
+		fmt.Println("SHT31 serial read failed:", err)
+	} else {
+		fmt.Printf("SHT31 serial number: %08x\n", serial)
+	}
+	// Soft-reset the sensor when the adapter comes back after an unplug
+	onReconnect(sht31_dev, func(conn i2c.Conn) error {
+		s, err := sht31.NewSHT31(conn)
+		if err != nil {
+			return err
+		}
+		return s.Reinit()
+	})
 
-	temp := sensor.ReadTemperature()
-	hum := sensor.ReadHumidity()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	temp, hum, err := sensor.MeasureContext(ctx)
+	cancel()
+	if err != nil {
+		fmt.Println("SHT31 read failed:", err)
+	}
 
 	fmt.Printf("Temperature: %.2f °C, Humidity: %.2f %%\n", temp, hum)
 
 	fmt.Println("...NewDisplay...")
 	// Create a Display from a I2c Device & a Screen
-	display, err := ssh1107.NewDisplay(ssh1107_dev, ssh1107.NewScreen(128, 128))
+	display, err := ssh1107.NewDisplay(sched.Wrap(ssh1107_dev, i2c.PriorityLow), ssh1107.NewScreen(128, 128))
 	if err != nil {
 		log.Fatalf("SH1107 display init failed: %v", err)
 	}
+	// Resend the init sequence when the adapter comes back after an unplug
+	onReconnect(ssh1107_dev, func(conn i2c.Conn) error {
+		d, err := ssh1107.NewDisplay(conn, ssh1107.NewScreen(128, 128))
+		if err != nil {
+			return err
+		}
+		return d.Initialize()
+	})
 	// Initialize a timer for automatic screen switching
 	autoSwitchTicker := time.NewTicker(10 * time.Second)
 	defer autoSwitchTicker.Stop()
@@ -436,10 +740,13 @@ func main() {
 	logoScreen := &LogoScreen{display: display}
 	clockScreen := &ClockScreen{display: display, mu: &sync.RWMutex{}}
 	shellyScreen := &ShellyScreen{display: display, mu: &sync.RWMutex{}}
+	sensorScreen := &SensorScreen{display: display, sensor: sensor, err: errors.New("no reading yet"), mu: &sync.RWMutex{}}
+	http.HandleFunc("/sensor", sensorScreen.serveSensor)
+	go sensorScreen.poll(time.Second)
 
 	// Create screen manager
 	screenManager := &ScreenManager{
-		screens:      []Screen{logoScreen, clockScreen, shellyScreen},
+		screens:      []Screen{logoScreen, clockScreen, shellyScreen, sensorScreen},
 		currentIndex: 0,
 	}
 
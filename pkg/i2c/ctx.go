@@ -0,0 +1,153 @@
+package i2c
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// Kernel side timeout and retries, from <linux/i2c-dev.h>
+const (
+	I2C_RETRIES = 0x0701
+	I2C_TIMEOUT = 0x0702
+)
+
+// SetTimeout sets how long the adapter waits for a transfer to complete.
+// The kernel counts in units of 10ms. The setting is one of the adapter,
+// shared by all its devices.
+func (dev *I2CDevice) SetTimeout(timeout time.Duration) error {
+	ticks := (timeout + 10*time.Millisecond - 1) / (10 * time.Millisecond)
+	if ticks <= 0 {
+		return fmt.Errorf("invalid timeout %v", timeout)
+	}
+	return ioctl(dev.File.Fd(), I2C_TIMEOUT, uintptr(ticks))
+}
+
+// SetRetries sets how many times the adapter retries a transfer that lost
+// arbitration, for all its devices
+func (dev *I2CDevice) SetRetries(retries int) error {
+	if retries < 0 {
+		return fmt.Errorf("invalid retry count %d", retries)
+	}
+	return ioctl(dev.File.Fd(), I2C_RETRIES, uintptr(retries))
+}
+
+// The context-aware transfers check ctx between transactions rather than
+// running them on a goroutine: a transfer handed to the kernel cannot be
+// interrupted, and abandoning it would leave it running on the bus. A
+// transfer in progress on an adapter is bounded by the adapter timeout, see
+// Options.Timeout; a round-trip to a netbus server is not interrupted
+// either. Connections that wait before a transfer, such as a SchedConn
+// waiting for the bus, implement ContextConn to stop waiting when ctx is
+// done.
+
+// ContextConn is a connection whose transfers can give up when a context is
+// done
+type ContextConn interface {
+	ReadContext(ctx context.Context, buf []byte) (int, error)
+	WriteContext(ctx context.Context, buf []byte) (int, error)
+	TxContext(ctx context.Context, w, r []byte) error
+}
+
+// ReadContext reads from c, unless ctx is done
+func ReadContext(ctx context.Context, c Conn, buf []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if cc, ok := c.(ContextConn); ok {
+		return cc.ReadContext(ctx, buf)
+	}
+	return c.Read(buf)
+}
+
+// WriteContext writes to c, unless ctx is done
+func WriteContext(ctx context.Context, c Conn, buf []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if cc, ok := c.(ContextConn); ok {
+		return cc.WriteContext(ctx, buf)
+	}
+	return c.Write(buf)
+}
+
+// TxContext runs a combined transfer on c, unless ctx is done
+func TxContext(ctx context.Context, c Conn, w, r []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if cc, ok := c.(ContextConn); ok {
+		return cc.TxContext(ctx, w, r)
+	}
+	return c.Tx(w, r)
+}
+
+// ReadContext reads bytes from the I2C device, unless ctx is done
+func (dev *I2CDevice) ReadContext(ctx context.Context, buf []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return dev.Read(buf)
+}
+
+// WriteContext writes bytes to the I2C device, unless ctx is done
+func (dev *I2CDevice) WriteContext(ctx context.Context, buf []byte) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return dev.Write(buf)
+}
+
+// TxContext runs a combined transfer, unless ctx is done
+func (dev *I2CDevice) TxContext(ctx context.Context, w, r []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return dev.Tx(w, r)
+}
+
+// RetryPolicy retries transfers failing with a transient error, waiting
+// Backoff before the first retry and doubling the wait up to MaxBackoff
+type RetryPolicy struct {
+	Attempts   int // Total number of attempts, 1 disables retries
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is suited to a USB adapter occasionally reporting EIO
+var DefaultRetryPolicy = RetryPolicy{
+	Attempts:   3,
+	Backoff:    2 * time.Millisecond,
+	MaxBackoff: 50 * time.Millisecond,
+}
+
+// IsTransient reports whether a transfer failing with err is worth retrying
+func IsTransient(err error) bool {
+	return errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.EIO)
+}
+
+// Do runs op until it succeeds, fails with a non transient error, runs out
+// of attempts or ctx is done
+func (p RetryPolicy) Do(ctx context.Context, op func() error) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil || !IsTransient(err) || attempt >= p.Attempts {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package i2c
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+	calls := 0
+	err := policy.Do(context.Background(), func() error {
+		calls++
+		if calls < 3 {
+			return syscall.EIO
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("got %v after %d calls, want success after 3", err, calls)
+	}
+
+	calls = 0
+	err = policy.Do(context.Background(), func() error {
+		calls++
+		return syscall.ENXIO
+	})
+	if !errors.Is(err, syscall.ENXIO) || calls != 1 {
+		t.Errorf("got %v after %d calls, want ENXIO without retry", err, calls)
+	}
+}
+
+func TestTxContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	log := &orderLog{}
+	conn := &loggedConn{fakeConn{present: true}, "tx", log}
+	if err := TxContext(ctx, conn, []byte{0x24, 0x00}, make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := TxContext(ctx, conn, []byte{0x24, 0x00}, make([]byte, 6)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want Canceled", err)
+	}
+	if got := log.String(); got != "tx" {
+		t.Errorf("got transfers %q, want none once cancelled", got)
+	}
+}
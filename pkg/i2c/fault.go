@@ -0,0 +1,154 @@
+package i2c
+
+import (
+	"math/rand"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FaultPolicy configures the faults injected by a FaultConn. The zero value
+// injects nothing, and every fault is drawn from a generator seeded with
+// Seed so that a failing test can be reproduced.
+type FaultPolicy struct {
+	Seed int64
+
+	ErrEvery int   // Fail every Nth operation
+	Err      error // Error of failed operations, a NACK (ENXIO) by default
+
+	BitFlipRate  float64 // Probability for each byte read to get a bit flipped
+	TruncateRate float64 // Probability for a read to stop early
+
+	Delay     time.Duration // Latency added to operations
+	DelayRate float64       // Probability of adding Delay, always when zero
+}
+
+// FaultConn wraps a connection and injects faults into its operations
+type FaultConn struct {
+	conn   Conn
+	policy FaultPolicy
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	ops      int
+	injected int
+}
+
+var _ Conn = (*FaultConn)(nil)
+
+// NewFaultConn wraps conn with the given fault policy
+func NewFaultConn(conn Conn, policy FaultPolicy) *FaultConn {
+	if policy.Err == nil {
+		policy.Err = syscall.ENXIO
+	}
+	return &FaultConn{
+		conn:   conn,
+		policy: policy,
+		rand:   rand.New(rand.NewSource(policy.Seed)),
+	}
+}
+
+// Injected returns the number of faults injected so far
+func (f *FaultConn) Injected() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.injected
+}
+
+// Read reads from the device, possibly failing, truncating or corrupting the data
+func (f *FaultConn) Read(buf []byte) (int, error) {
+	if err := f.before(); err != nil {
+		return 0, err
+	}
+	n, err := f.conn.Read(buf)
+	if err != nil {
+		return n, err
+	}
+	n = f.truncate(buf[:n])
+	f.corrupt(buf[:n])
+	return n, nil
+}
+
+// Write writes to the device, possibly failing
+func (f *FaultConn) Write(buf []byte) (int, error) {
+	if err := f.before(); err != nil {
+		return 0, err
+	}
+	return f.conn.Write(buf)
+}
+
+// Tx runs a combined transfer, possibly failing or corrupting the data read.
+// A truncated read leaves the missing bytes at 0xFF, as read from an idle bus.
+func (f *FaultConn) Tx(w, r []byte) error {
+	if err := f.before(); err != nil {
+		return err
+	}
+	if err := f.conn.Tx(w, r); err != nil {
+		return err
+	}
+	n := f.truncate(r)
+	for i := n; i < len(r); i++ {
+		r[i] = 0xFF
+	}
+	f.corrupt(r[:n])
+	return nil
+}
+
+// Close closes the wrapped connection
+func (f *FaultConn) Close() error {
+	return f.conn.Close()
+}
+
+// Capabilities returns the capabilities of the wrapped connection
+func (f *FaultConn) Capabilities() (Capabilities, error) {
+	return CapabilitiesOf(f.conn)
+}
+
+// before counts an operation, adds latency and decides whether it fails
+func (f *FaultConn) before() error {
+	f.mu.Lock()
+	f.ops++
+	fail := f.policy.ErrEvery > 0 && f.ops%f.policy.ErrEvery == 0
+	delay := f.policy.Delay > 0 && (f.policy.DelayRate == 0 || f.rand.Float64() < f.policy.DelayRate)
+	if fail {
+		f.injected++
+	}
+	if delay {
+		f.injected++
+	}
+	f.mu.Unlock()
+
+	if delay {
+		time.Sleep(f.policy.Delay)
+	}
+	if fail {
+		return f.policy.Err
+	}
+	return nil
+}
+
+// truncate returns how many of the bytes read are kept
+func (f *FaultConn) truncate(buf []byte) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(buf) == 0 || f.policy.TruncateRate == 0 || f.rand.Float64() >= f.policy.TruncateRate {
+		return len(buf)
+	}
+	f.injected++
+	return f.rand.Intn(len(buf))
+}
+
+// corrupt flips random bits of the bytes read
+func (f *FaultConn) corrupt(buf []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.policy.BitFlipRate == 0 {
+		return
+	}
+	for i := range buf {
+		if f.rand.Float64() < f.policy.BitFlipRate {
+			buf[i] ^= 1 << f.rand.Intn(8)
+			f.injected++
+		}
+	}
+}
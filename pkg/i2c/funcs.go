@@ -0,0 +1,185 @@
+package i2c
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Adapter functionality bits, as returned by the I2C_FUNCS ioctl
+const (
+	I2C_FUNCS = 0x0705
+
+	I2C_FUNC_I2C                    = 0x00000001
+	I2C_FUNC_10BIT_ADDR             = 0x00000002
+	I2C_FUNC_PROTOCOL_MANGLING      = 0x00000004
+	I2C_FUNC_SMBUS_PEC              = 0x00000008
+	I2C_FUNC_NOSTART                = 0x00000010
+	I2C_FUNC_SLAVE                  = 0x00000020
+	I2C_FUNC_SMBUS_BLOCK_PROC_CALL  = 0x00008000
+	I2C_FUNC_SMBUS_QUICK            = 0x00010000
+	I2C_FUNC_SMBUS_READ_BYTE        = 0x00020000
+	I2C_FUNC_SMBUS_WRITE_BYTE       = 0x00040000
+	I2C_FUNC_SMBUS_READ_BYTE_DATA   = 0x00080000
+	I2C_FUNC_SMBUS_WRITE_BYTE_DATA  = 0x00100000
+	I2C_FUNC_SMBUS_READ_WORD_DATA   = 0x00200000
+	I2C_FUNC_SMBUS_WRITE_WORD_DATA  = 0x00400000
+	I2C_FUNC_SMBUS_PROC_CALL        = 0x00800000
+	I2C_FUNC_SMBUS_READ_BLOCK_DATA  = 0x01000000
+	I2C_FUNC_SMBUS_WRITE_BLOCK_DATA = 0x02000000
+	I2C_FUNC_SMBUS_READ_I2C_BLOCK   = 0x04000000
+	I2C_FUNC_SMBUS_WRITE_I2C_BLOCK  = 0x08000000
+	I2C_FUNC_SMBUS_HOST_NOTIFY      = 0x10000000
+)
+
+// funcNames gives a readable name for each functionality bit
+var funcNames = []struct {
+	bit  uint32
+	name string
+}{
+	{I2C_FUNC_I2C, "I2C"},
+	{I2C_FUNC_10BIT_ADDR, "10-bit addressing"},
+	{I2C_FUNC_PROTOCOL_MANGLING, "protocol mangling"},
+	{I2C_FUNC_SMBUS_PEC, "SMBus PEC"},
+	{I2C_FUNC_NOSTART, "no start"},
+	{I2C_FUNC_SLAVE, "slave mode"},
+	{I2C_FUNC_SMBUS_BLOCK_PROC_CALL, "SMBus block process call"},
+	{I2C_FUNC_SMBUS_QUICK, "SMBus quick command"},
+	{I2C_FUNC_SMBUS_READ_BYTE, "SMBus receive byte"},
+	{I2C_FUNC_SMBUS_WRITE_BYTE, "SMBus send byte"},
+	{I2C_FUNC_SMBUS_READ_BYTE_DATA, "SMBus read byte"},
+	{I2C_FUNC_SMBUS_WRITE_BYTE_DATA, "SMBus write byte"},
+	{I2C_FUNC_SMBUS_READ_WORD_DATA, "SMBus read word"},
+	{I2C_FUNC_SMBUS_WRITE_WORD_DATA, "SMBus write word"},
+	{I2C_FUNC_SMBUS_PROC_CALL, "SMBus process call"},
+	{I2C_FUNC_SMBUS_READ_BLOCK_DATA, "SMBus block read"},
+	{I2C_FUNC_SMBUS_WRITE_BLOCK_DATA, "SMBus block write"},
+	{I2C_FUNC_SMBUS_READ_I2C_BLOCK, "I2C block read"},
+	{I2C_FUNC_SMBUS_WRITE_I2C_BLOCK, "I2C block write"},
+	{I2C_FUNC_SMBUS_HOST_NOTIFY, "SMBus host notify"},
+}
+
+// Capabilities is the decoded functionality of an I2C adapter
+type Capabilities struct {
+	Funcs uint32 // Raw I2C_FUNC_* bitmask
+
+	I2C              bool // Plain I2C transfers (read, write, I2C_RDWR)
+	TenBitAddr       bool // 10-bit addresses
+	ProtocolMangling bool // I2C_M_IGNORE_NAK and friends
+	PEC              bool // SMBus packet error checking
+	NoStart          bool // I2C_M_NOSTART
+	Slave            bool // Slave mode
+
+	SMBusQuick          bool
+	SMBusReadByte       bool
+	SMBusWriteByte      bool
+	SMBusReadByteData   bool
+	SMBusWriteByteData  bool
+	SMBusReadWordData   bool
+	SMBusWriteWordData  bool
+	SMBusProcCall       bool
+	SMBusReadBlockData  bool
+	SMBusWriteBlockData bool
+	SMBusBlockProcCall  bool
+	SMBusReadI2CBlock   bool
+	SMBusWriteI2CBlock  bool
+	SMBusHostNotify     bool
+}
+
+// Capable is implemented by connections that can report what their adapter supports
+type Capable interface {
+	Capabilities() (Capabilities, error)
+}
+
+// ParseFuncs decodes an I2C_FUNC_* bitmask
+func ParseFuncs(funcs uint32) Capabilities {
+	has := func(bit uint32) bool { return funcs&bit != 0 }
+	return Capabilities{
+		Funcs:               funcs,
+		I2C:                 has(I2C_FUNC_I2C),
+		TenBitAddr:          has(I2C_FUNC_10BIT_ADDR),
+		ProtocolMangling:    has(I2C_FUNC_PROTOCOL_MANGLING),
+		PEC:                 has(I2C_FUNC_SMBUS_PEC),
+		NoStart:             has(I2C_FUNC_NOSTART),
+		Slave:               has(I2C_FUNC_SLAVE),
+		SMBusQuick:          has(I2C_FUNC_SMBUS_QUICK),
+		SMBusReadByte:       has(I2C_FUNC_SMBUS_READ_BYTE),
+		SMBusWriteByte:      has(I2C_FUNC_SMBUS_WRITE_BYTE),
+		SMBusReadByteData:   has(I2C_FUNC_SMBUS_READ_BYTE_DATA),
+		SMBusWriteByteData:  has(I2C_FUNC_SMBUS_WRITE_BYTE_DATA),
+		SMBusReadWordData:   has(I2C_FUNC_SMBUS_READ_WORD_DATA),
+		SMBusWriteWordData:  has(I2C_FUNC_SMBUS_WRITE_WORD_DATA),
+		SMBusProcCall:       has(I2C_FUNC_SMBUS_PROC_CALL),
+		SMBusReadBlockData:  has(I2C_FUNC_SMBUS_READ_BLOCK_DATA),
+		SMBusWriteBlockData: has(I2C_FUNC_SMBUS_WRITE_BLOCK_DATA),
+		SMBusBlockProcCall:  has(I2C_FUNC_SMBUS_BLOCK_PROC_CALL),
+		SMBusReadI2CBlock:   has(I2C_FUNC_SMBUS_READ_I2C_BLOCK),
+		SMBusWriteI2CBlock:  has(I2C_FUNC_SMBUS_WRITE_I2C_BLOCK),
+		SMBusHostNotify:     has(I2C_FUNC_SMBUS_HOST_NOTIFY),
+	}
+}
+
+// Has reports whether all the functionality bits in mask are supported
+func (c Capabilities) Has(mask uint32) bool {
+	return c.Funcs&mask == mask
+}
+
+// Missing returns the names of the functionality bits in mask that are not supported
+func (c Capabilities) Missing(mask uint32) []string {
+	var missing []string
+	for _, f := range funcNames {
+		if mask&f.bit != 0 && c.Funcs&f.bit == 0 {
+			missing = append(missing, f.name)
+		}
+	}
+	return missing
+}
+
+// String lists the supported functionality
+func (c Capabilities) String() string {
+	var names []string
+	for _, f := range funcNames {
+		if c.Funcs&f.bit != 0 {
+			names = append(names, f.name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// Capabilities queries the adapter functionality through the I2C_FUNCS ioctl
+func (dev *I2CDevice) Capabilities() (Capabilities, error) {
+	var funcs uint // unsigned long in the kernel
+	if err := ioctl(dev.File.Fd(), I2C_FUNCS, uintptr(unsafe.Pointer(&funcs))); err != nil {
+		return Capabilities{}, fmt.Errorf("I2C_FUNCS: %w", err)
+	}
+	return ParseFuncs(uint32(funcs)), nil
+}
+
+// CapabilitiesOf returns the capabilities of the adapter behind c.
+// Connections that cannot report their capabilities are assumed to support
+// plain I2C only.
+func CapabilitiesOf(c Conn) (Capabilities, error) {
+	capable, ok := c.(Capable)
+	if !ok {
+		return ParseFuncs(I2C_FUNC_I2C), nil
+	}
+	return capable.Capabilities()
+}
+
+// Require checks that the adapter behind c supports all the functionality
+// bits in mask. Connections that cannot report their capabilities are
+// assumed to support everything.
+func Require(c Conn, mask uint32) error {
+	capable, ok := c.(Capable)
+	if !ok {
+		return nil
+	}
+	caps, err := capable.Capabilities()
+	if err != nil {
+		return err
+	}
+	if missing := caps.Missing(mask); len(missing) > 0 {
+		return fmt.Errorf("i2c adapter does not support %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -4,46 +4,203 @@ import (
 	"fmt"
 	"os"
 	"syscall"
+	"time"
 )
 
+// Conn is a connection to a single device on an I2C bus. Drivers only depend
+// on this interface so that fakes, tracers or muxed channels can be used in
+// place of a real /dev/i2c-N device.
+type Conn interface {
+	Read(buf []byte) (int, error)
+	Write(buf []byte) (int, error)
+	Tx(w, r []byte) error
+	Close() error
+}
+
 // I2CDevice represents an I2C device
 type I2CDevice struct {
 	File *os.File
+	Addr uint16
+	bus  int
+	opts Options
+	lock *os.File
+}
+
+// Options tunes how a device is claimed
+type Options struct {
+	TenBit bool // The address is a 10-bit one
+	Force  bool // Claim the address even if a kernel driver already uses it
+	PEC    bool // Use SMBus packet error checking
+
+	NoLock    bool          // Do not take the advisory lock of the address
+	LockWait  time.Duration // How long to wait for a lock held by another process, forever when negative
+	LockScope string        // Multiplexer channel the device is on, see Adapter.Scope
+
+	// Transfer timeout and arbitration retries of the adapter, left to
+	// the adapter defaults when zero. They bound how long a stuck adapter
+	// blocks a transfer, see SetTimeout and SetRetries.
+	Timeout time.Duration
+	Retries int
 }
 
+var _ Conn = (*I2CDevice)(nil)
+
 // I2C Constants
 const (
-	I2C_SLAVE = 0x0703
+	I2C_SLAVE       = 0x0703
+	I2C_SLAVE_FORCE = 0x0706
+	I2C_TENBIT      = 0x0704
+	I2C_PEC         = 0x0708
+	I2C_RDWR        = 0x0707
 )
 
 // Init initializes the I2C bus and returns an I2CDevice
 func Init(bus int, address uint8) (*I2CDevice, error) {
+	return InitWithOptions(bus, uint16(address), Options{})
+}
+
+// InitWithOptions initializes the I2C bus and returns an I2CDevice, claiming
+// the address as set by opts. Unless opts.NoLock is set, the address is
+// locked against the other processes using this package, a LockError
+// telling who holds it otherwise. The device is used unlocked when the lock
+// file cannot be created.
+func InitWithOptions(bus int, address uint16, opts Options) (*I2CDevice, error) {
+	if !opts.TenBit && address > 0x7F {
+		return nil, fmt.Errorf("invalid 7-bit address %#x", address)
+	}
+	if address > 0x3FF {
+		return nil, fmt.Errorf("invalid 10-bit address %#x", address)
+	}
+
+	var lock *os.File
+	if !opts.NoLock {
+		var err error
+		if lock, err = lockDevice(bus, opts.LockScope, address, opts.LockWait); err != nil {
+			return nil, err
+		}
+	}
+
 	filename := fmt.Sprintf("/dev/i2c-%d", bus)
-	file, err := os.OpenFile(filename, os.O_RDWR, os.ModeExclusive)
+	file, err := os.OpenFile(filename, os.O_RDWR, 0)
 	if err != nil {
+		closeLock(lock)
 		return nil, err
 	}
+	dev := &I2CDevice{File: file, Addr: address, bus: bus, opts: opts, lock: lock}
 
-	if err := ioctl(file.Fd(), I2C_SLAVE, uintptr(address)); err != nil {
+	if err := dev.claim(); err != nil {
+		dev.Close()
 		return nil, err
 	}
+	return dev, nil
+}
 
-	return &I2CDevice{File: file}, nil
+// busName names the bus of the device in the statistics, with the
+// multiplexer channel it is on if any
+func (dev *I2CDevice) busName() string {
+	if dev.opts.LockScope != "" {
+		return fmt.Sprintf("i2c-%d/%s", dev.bus, dev.opts.LockScope)
+	}
+	return fmt.Sprintf("i2c-%d", dev.bus)
+}
+
+// claim sets the address mode and slave address of the file descriptor
+func (dev *I2CDevice) claim() error {
+	fd := dev.File.Fd()
+
+	var needed uint32
+	if dev.opts.TenBit {
+		needed |= I2C_FUNC_10BIT_ADDR
+	}
+	if dev.opts.PEC {
+		needed |= I2C_FUNC_SMBUS_PEC
+	}
+	if needed != 0 {
+		if err := Require(dev, needed); err != nil {
+			return err
+		}
+	}
+
+	// The address mode must be set first, the kernel checks the address against it
+	if err := ioctl(fd, I2C_TENBIT, boolArg(dev.opts.TenBit)); err != nil {
+		return fmt.Errorf("I2C_TENBIT: %w", err)
+	}
+
+	request := uint(I2C_SLAVE)
+	if dev.opts.Force {
+		request = I2C_SLAVE_FORCE
+	}
+	if err := ioctl(fd, request, uintptr(dev.Addr)); err != nil {
+		return err
+	}
+
+	if err := ioctl(fd, I2C_PEC, boolArg(dev.opts.PEC)); err != nil {
+		return fmt.Errorf("I2C_PEC: %w", err)
+	}
+
+	if dev.opts.Timeout > 0 {
+		if err := dev.SetTimeout(dev.opts.Timeout); err != nil {
+			return fmt.Errorf("I2C_TIMEOUT: %w", err)
+		}
+	}
+	if dev.opts.Retries > 0 {
+		if err := dev.SetRetries(dev.opts.Retries); err != nil {
+			return fmt.Errorf("I2C_RETRIES: %w", err)
+		}
+	}
+	return nil
+}
+
+// boolArg converts a flag to an ioctl argument
+func boolArg(b bool) uintptr {
+	if b {
+		return 1
+	}
+	return 0
 }
 
 // Read reads bytes from the I2C device
 func (dev *I2CDevice) Read(buf []byte) (int, error) {
-	return dev.File.Read(buf)
+	start := time.Now()
+	n, err := dev.File.Read(buf)
+	DefaultMetrics.Observe(dev.busName(), dev.Addr, 0, n, time.Since(start), err)
+	return n, err
 }
 
 // Write writes bytes to the I2C device
 func (dev *I2CDevice) Write(buf []byte) (int, error) {
-	return dev.File.Write(buf)
+	start := time.Now()
+	n, err := dev.File.Write(buf)
+	DefaultMetrics.Observe(dev.busName(), dev.Addr, n, 0, time.Since(start), err)
+	return n, err
+}
+
+// Tx writes w then reads into r as a single combined transfer, with a
+// repeated start between the two. Either of them may be empty.
+func (dev *I2CDevice) Tx(w, r []byte) error {
+	var flags uint16
+	if dev.opts.TenBit {
+		flags = I2C_M_TEN
+	}
+
+	var msgs []Msg
+	if len(w) > 0 {
+		msgs = append(msgs, Msg{Addr: dev.Addr, Flags: flags, Buf: w})
+	}
+	if len(r) > 0 {
+		msgs = append(msgs, Msg{Addr: dev.Addr, Flags: flags | I2C_M_RD, Buf: r})
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+	return dev.Transfer(msgs...)
 }
 
-// Close closes the I2C device
+// Close closes the I2C device and releases its lock
 func (dev *I2CDevice) Close() error {
-	return dev.File.Close()
+	err := dev.File.Close()
+	closeLock(dev.lock)
+	return err
 }
 
 // ioctl performs an IO control operation
@@ -0,0 +1,166 @@
+package i2c
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// LockDir is where the lock files of the devices are created
+var LockDir = "/run/lock"
+
+// lockPollInterval is how often a held lock is retried while waiting for it
+const lockPollInterval = 10 * time.Millisecond
+
+// LockError is returned when a device is locked by another process. It
+// matches syscall.EBUSY, like an address in use by a kernel driver.
+type LockError struct {
+	Path    string // Lock file
+	PID     int    // Process holding the lock, 0 when unknown
+	Command string // Command name of that process
+}
+
+func (e *LockError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("%s is locked by another process", e.Path)
+	}
+	return fmt.Sprintf("%s is locked by pid %d (%s)", e.Path, e.PID, e.Command)
+}
+
+func (e *LockError) Unwrap() error {
+	return syscall.EBUSY
+}
+
+// LockPath returns the lock file of address on bus. There is one per
+// address, so that processes driving different devices of a bus do not get
+// in each other's way. The scope, empty for devices directly on the bus,
+// tells apart the devices sharing an address on different multiplexer
+// channels.
+func LockPath(bus int, scope string, address uint16) string {
+	if scope == "" {
+		return filepath.Join(LockDir, fmt.Sprintf("i2c-%d-%#02x.lock", bus, address))
+	}
+	return filepath.Join(LockDir, fmt.Sprintf("i2c-%d-%s-%#02x.lock", bus, scope, address))
+}
+
+// lockDevice takes the advisory lock of address on bus. A lock held by
+// another process is waited for up to wait, forever when wait is negative.
+// The lock is released when the returned file is closed, or when the
+// process dies. Locking being advisory, a lock directory that is missing,
+// not writable or on a read-only file system is not an error: the device is
+// then used unlocked, and the returned file is nil. Any other failure to
+// open the lock file is.
+func lockDevice(bus int, scope string, address uint16, wait time.Duration) (*os.File, error) {
+	path := LockPath(bus, scope, address)
+	deadline := time.Now().Add(wait)
+	for {
+		file, err := openLock(path)
+		if lockUnavailable(err) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("i2c lock %s: %w", path, err)
+		}
+
+		remaining := wait
+		if wait >= 0 {
+			remaining = max(time.Until(deadline), 0)
+		}
+		if err := flock(file, remaining); err != nil {
+			file.Close()
+			if errors.Is(err, syscall.EWOULDBLOCK) {
+				return nil, lockHolder(path)
+			}
+			return nil, fmt.Errorf("i2c lock %s: %w", path, err)
+		}
+
+		// The previous holder removes the file when done, so the lock may
+		// have been taken on a removed file: lock the current one instead
+		if current, err := os.Stat(path); err == nil {
+			if locked, err := file.Stat(); err == nil && os.SameFile(current, locked) {
+				// Leave our name for the processes failing to get the lock
+				file.Truncate(0)
+				file.WriteAt([]byte(fmt.Sprintf("%d %s\n", os.Getpid(), filepath.Base(os.Args[0]))), 0)
+				return file, nil
+			}
+		}
+		file.Close()
+	}
+}
+
+// openLock opens the lock file at path, creating it when needed. It is made
+// writable by all, whatever the umask, so that other users can take the
+// lock too. An existing file is opened without O_CREAT, which
+// fs.protected_regular refuses in /run/lock for files of other users.
+func openLock(path string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR, 0)
+		if errors.Is(err, fs.ErrPermission) {
+			// flock works on a read-only file too, only our name is not left
+			file, err = os.Open(path)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return file, err
+		}
+
+		file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if errors.Is(err, fs.ErrExist) {
+			continue // Created by another process meanwhile
+		}
+		if err != nil {
+			return nil, err
+		}
+		file.Chmod(0666)
+		return file, nil
+	}
+}
+
+// lockUnavailable reports whether openLock failed with err because locking
+// is not possible at all, rather than because of a passing failure
+func lockUnavailable(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) || errors.Is(err, syscall.EROFS)
+}
+
+// closeLock releases a lock taken by lockDevice, if any. The file is removed
+// first, while still locked, so that no lock file is left behind.
+func closeLock(lock *os.File) {
+	if lock != nil {
+		os.Remove(lock.Name())
+		lock.Close()
+	}
+}
+
+// flock locks file exclusively, waiting up to wait for it
+func flock(file *os.File, wait time.Duration) error {
+	fd := int(file.Fd())
+	if wait < 0 {
+		for {
+			err := syscall.Flock(fd, syscall.LOCK_EX)
+			if err != syscall.EINTR {
+				return err
+			}
+		}
+	}
+
+	deadline := time.Now().Add(wait)
+	for {
+		err := syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+		if err != syscall.EWOULDBLOCK || !time.Now().Before(deadline) {
+			return err
+		}
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// lockHolder reports the process holding the lock file at path
+func lockHolder(path string) *LockError {
+	lerr := &LockError{Path: path}
+	if data, err := os.ReadFile(path); err == nil {
+		fmt.Sscanf(string(data), "%d %s", &lerr.PID, &lerr.Command)
+	}
+	return lerr
+}
@@ -0,0 +1,99 @@
+package i2c
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLockDevice(t *testing.T) {
+	LockDir = t.TempDir()
+	defer func() { LockDir = "/run/lock" }()
+
+	held, err := lockDevice(1, "", 0x44, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(LockPath(1, "", 0x44)); err != nil || fi.Mode().Perm() != 0666 {
+		t.Errorf("lock file not writable by all: %v %v", fi.Mode(), err)
+	}
+
+	// flock locks belong to the open file, so a second open conflicts even
+	// from the same process
+	_, err = lockDevice(1, "", 0x44, 0)
+	var lerr *LockError
+	if !errors.As(err, &lerr) || lerr.PID != os.Getpid() {
+		t.Fatalf("got %v, want a LockError naming pid %d", err, os.Getpid())
+	}
+	if !errors.Is(err, syscall.EBUSY) {
+		t.Error("LockError does not match EBUSY")
+	}
+
+	for _, scope := range []string{"", "0x70.5"} {
+		addr := uint16(0x44)
+		if scope == "" {
+			addr = 0x3c
+		}
+		other, err := lockDevice(1, scope, addr, 0)
+		if err != nil {
+			t.Fatalf("lock of %q %#02x: %v", scope, addr, err)
+		}
+		closeLock(other)
+	}
+
+	start := time.Now()
+	if _, err := lockDevice(1, "", 0x44, 30*time.Millisecond); !errors.As(err, &lerr) {
+		t.Fatalf("got %v, want a LockError", err)
+	}
+	if time.Since(start) < 30*time.Millisecond {
+		t.Error("gave up before the lock wait elapsed")
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		closeLock(held)
+	}()
+	lock, err := lockDevice(1, "", 0x44, time.Second)
+	if err != nil {
+		t.Fatalf("lock not taken once released: %v", err)
+	}
+	closeLock(lock)
+
+	if files, _ := filepath.Glob(filepath.Join(LockDir, "*")); len(files) != 0 {
+		t.Errorf("lock files left behind: %v", files)
+	}
+}
+
+func TestLockUnavailable(t *testing.T) {
+	LockDir = filepath.Join(t.TempDir(), "missing")
+	defer func() { LockDir = "/run/lock" }()
+
+	lock, err := lockDevice(1, "", 0x44, 0)
+	if lock != nil || err != nil {
+		t.Errorf("got %v, %v, want to go on unlocked", lock, err)
+	}
+
+	// Any other failure is reported rather than ignored
+	LockDir = filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(LockDir, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if lock, err := lockDevice(1, "", 0x44, 0); !errors.Is(err, syscall.ENOTDIR) {
+		closeLock(lock)
+		t.Errorf("got %v with a file as lock dir, want ENOTDIR", err)
+	}
+}
+
+func TestAdapterScope(t *testing.T) {
+	a := Adapter{Number: 1}
+	scoped := Scope(Scope(a, "0x70.5"), "0x71.2").(Adapter)
+	if got := scoped.Options.LockScope; got != "0x70.5-0x71.2" {
+		t.Errorf("got scope %q", got)
+	}
+	if a.Options.LockScope != "" {
+		t.Error("scoping changed the adapter")
+	}
+}
@@ -0,0 +1,169 @@
+package netbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"dev/pkg/i2c"
+)
+
+// DefaultTimeout bounds a request and its response
+const DefaultTimeout = 5 * time.Second
+
+// Client is a bus exported by a remote Server. Requests are sent one at a
+// time, so connections opened on the same client never interleave. The
+// transactions are counted in i2c.DefaultMetrics, under the address of the
+// server as bus name.
+type Client struct {
+	Timeout time.Duration // Deadline of a request, none when zero
+
+	name   string
+	mu     sync.Mutex
+	nc     net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+	broken error
+}
+
+var _ i2c.Bus = (*Client)(nil)
+
+// Dial connects to the server at the TCP address
+func Dial(address string) (*Client, error) {
+	nc, err := net.DialTimeout("tcp", address, DefaultTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(nc), nil
+}
+
+// NewClient creates a client talking to a server over nc
+func NewClient(nc net.Conn) *Client {
+	return &Client{
+		Timeout: DefaultTimeout,
+		name:    nc.RemoteAddr().String(),
+		nc:      nc,
+		r:       bufio.NewReader(nc),
+		w:       bufio.NewWriter(nc),
+	}
+}
+
+// Open returns a connection to addr on the remote bus
+func (c *Client) Open(addr uint16) (i2c.Conn, error) {
+	resp, err := c.call(binary.BigEndian.AppendUint16([]byte{opOpen}, addr))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) != 4 {
+		return nil, ErrMalformed
+	}
+	conn := &remoteConn{client: c, handle: binary.BigEndian.Uint32(resp)}
+	return i2c.DefaultMetrics.Wrap(conn, c.name, addr), nil
+}
+
+// Close disconnects from the server, which closes the remote connections
+func (c *Client) Close() error {
+	return c.nc.Close()
+}
+
+// call sends a request and waits for its response. Once the stream is
+// broken, every call fails with the error that broke it.
+func (c *Client) call(req []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.broken != nil {
+		return nil, c.broken
+	}
+	if c.Timeout > 0 {
+		c.nc.SetDeadline(time.Now().Add(c.Timeout))
+	}
+	resp, err := c.roundTrip(req)
+	if err != nil {
+		c.broken = fmt.Errorf("netbus: %w", err)
+		c.nc.Close()
+		return nil, c.broken
+	}
+	return decodeResponse(resp)
+}
+
+func (c *Client) roundTrip(req []byte) ([]byte, error) {
+	if err := writeFrame(c.w, req); err != nil {
+		return nil, err
+	}
+	return readFrame(c.r)
+}
+
+// remoteConn is a connection opened on a remote bus
+type remoteConn struct {
+	client *Client
+	handle uint32
+}
+
+var _ i2c.Capable = (*remoteConn)(nil)
+
+// request starts a request on the connection
+func (c *remoteConn) request(op byte) []byte {
+	return binary.BigEndian.AppendUint32([]byte{op}, c.handle)
+}
+
+func (c *remoteConn) Read(buf []byte) (int, error) {
+	if len(buf) > 0xFFFF {
+		return 0, fmt.Errorf("netbus: read of %d bytes is too long", len(buf))
+	}
+	resp, err := c.client.call(binary.BigEndian.AppendUint16(c.request(opRead), uint16(len(buf))))
+	if err != nil {
+		return 0, err
+	}
+	return copy(buf, resp), nil
+}
+
+func (c *remoteConn) Write(buf []byte) (int, error) {
+	if len(buf) > 0xFFFF {
+		return 0, fmt.Errorf("netbus: write of %d bytes is too long", len(buf))
+	}
+	resp, err := c.client.call(append(c.request(opWrite), buf...))
+	if err != nil {
+		return 0, err
+	}
+	if len(resp) != 4 {
+		return 0, ErrMalformed
+	}
+	return int(binary.BigEndian.Uint32(resp)), nil
+}
+
+func (c *remoteConn) Tx(w, r []byte) error {
+	if len(w) > 0xFFFF || len(r) > 0xFFFF {
+		return fmt.Errorf("netbus: transfer of %d+%d bytes is too long", len(w), len(r))
+	}
+	req := binary.BigEndian.AppendUint16(c.request(opTx), uint16(len(r)))
+	resp, err := c.client.call(append(req, w...))
+	if err != nil {
+		return err
+	}
+	if len(resp) != len(r) {
+		return ErrMalformed
+	}
+	copy(r, resp)
+	return nil
+}
+
+func (c *remoteConn) Close() error {
+	_, err := c.client.call(c.request(opClose))
+	return err
+}
+
+// Capabilities returns the capabilities of the remote adapter
+func (c *remoteConn) Capabilities() (i2c.Capabilities, error) {
+	resp, err := c.client.call(c.request(opFuncs))
+	if err != nil {
+		return i2c.Capabilities{}, err
+	}
+	if len(resp) != 4 {
+		return i2c.Capabilities{}, ErrMalformed
+	}
+	return i2c.ParseFuncs(binary.BigEndian.Uint32(resp)), nil
+}
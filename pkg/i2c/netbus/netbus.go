@@ -0,0 +1,105 @@
+// Package netbus exports an I2C bus over TCP, so that devices plugged into a
+// headless box can be driven from another machine.
+//
+// Every message is a frame made of a big endian uint32 length followed by
+// the payload. A request is an opcode followed by its arguments, the handle
+// of the connection first for all of them but opOpen. A response is a status
+// byte followed by the result, or by the error when the status is not
+// statusOK. Syscall errors keep their errno, so that the client sees the
+// same errors as a local bus.
+//
+// The protocol has no authentication nor encryption: whoever reaches the
+// server gets raw read and write access to the bus. Listen on loopback and
+// reach it through an SSH tunnel, or only on a trusted network.
+package netbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// Request opcodes
+const (
+	opOpen  = 0x01 // addr uint16 -> handle uint32
+	opClose = 0x02 // handle
+	opRead  = 0x03 // handle, len uint16 -> data
+	opWrite = 0x04 // handle, data -> n uint32
+	opTx    = 0x05 // handle, read len uint16, write data -> read data
+	opFuncs = 0x06 // handle -> I2C_FUNC_* mask uint32
+)
+
+// Response status
+const (
+	statusOK    = 0x00 // Followed by the result
+	statusErrno = 0x01 // Followed by a uint32 errno
+	statusError = 0x02 // Followed by the error message
+)
+
+// MaxFrame is the largest frame accepted, a request carries at most a
+// 64 KiB payload plus its header
+const MaxFrame = 1<<16 + 16
+
+// ErrMalformed is returned for a frame that cannot be decoded
+var ErrMalformed = errors.New("netbus: malformed frame")
+
+// writeFrame writes payload as a single frame
+func writeFrame(w *bufio.Writer, payload []byte) error {
+	var hdr [4]byte
+	binary.BigEndian.PutUint32(hdr[:], uint32(len(payload)))
+	if _, err := w.Write(hdr[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+// readFrame reads the payload of the next frame
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(hdr[:])
+	if size > MaxFrame {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMalformed, size)
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// encodeError builds the response carrying err
+func encodeError(err error) []byte {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return binary.BigEndian.AppendUint32([]byte{statusErrno}, uint32(errno))
+	}
+	return append([]byte{statusError}, err.Error()...)
+}
+
+// decodeResponse returns the result of a response, or the error it carries
+func decodeResponse(resp []byte) ([]byte, error) {
+	if len(resp) == 0 {
+		return nil, ErrMalformed
+	}
+	switch resp[0] {
+	case statusOK:
+		return resp[1:], nil
+	case statusErrno:
+		if len(resp) != 5 {
+			return nil, ErrMalformed
+		}
+		return nil, syscall.Errno(binary.BigEndian.Uint32(resp[1:]))
+	case statusError:
+		return nil, errors.New(string(resp[1:]))
+	}
+	return nil, fmt.Errorf("%w: status %#02x", ErrMalformed, resp[0])
+}
@@ -0,0 +1,116 @@
+package netbus
+
+import (
+	"errors"
+	"math"
+	"net"
+	"syscall"
+	"testing"
+
+	"dev/pkg/i2c"
+	"dev/pkg/i2c/sim"
+	"dev/pkg/sht31"
+)
+
+// newLoopback exports a simulated bus on a loopback port and connects to it
+func newLoopback(t *testing.T) (*Client, *sim.Bus) {
+	t.Helper()
+	bus := sim.NewBus()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go NewServer(bus).Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	client, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, bus
+}
+
+func TestRemoteSensor(t *testing.T) {
+	client, bus := newLoopback(t)
+	bus.Attach(sht31.SHT31DefaultAddr, sim.NewSHT31(21.5, 48.25))
+
+	conn, err := client.Open(sht31.SHT31DefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sensor, err := sht31.NewSHT31(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	temp, hum, ok := sensor.ReadBoth()
+	if !ok {
+		t.Fatal("ReadBoth failed")
+	}
+	if math.Abs(temp-21.5) > 0.02 || math.Abs(hum-48.25) > 0.02 {
+		t.Errorf("got %.2f °C %.2f %%, want 21.50 °C 48.25 %%", temp, hum)
+	}
+	if stat := sensor.ReadStatus(); stat != 0x8010 {
+		t.Errorf("got status %#04x, want 0x8010", stat)
+	}
+
+	counted := false
+	for _, s := range i2c.Stats() {
+		if s.Bus == client.name && s.Addr == sht31.SHT31DefaultAddr && s.Transactions > 0 {
+			counted = true
+		}
+	}
+	if !counted {
+		t.Errorf("transactions not counted under %s", client.name)
+	}
+}
+
+func TestRemoteErrors(t *testing.T) {
+	client, _ := newLoopback(t)
+
+	conn, err := client.Open(0x45)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte{0x24, 0x00}); !errors.Is(err, syscall.ENXIO) {
+		t.Errorf("got %v, want ENXIO", err)
+	}
+	if err := conn.Tx([]byte{0xF3, 0x2D}, make([]byte, 3)); !errors.Is(err, syscall.ENXIO) {
+		t.Errorf("got %v, want ENXIO", err)
+	}
+	if _, err := client.Open(0x400); err == nil || err.Error() != "invalid address 0x400" {
+		t.Errorf("got %v, want the remote error", err)
+	}
+
+	conn.Close()
+	if _, err := conn.Read(make([]byte, 1)); !errors.Is(err, syscall.EBADF) {
+		t.Errorf("got %v after close, want EBADF", err)
+	}
+
+	client.Close()
+	if _, err := client.Open(0x44); err == nil {
+		t.Error("open succeeded on a closed client")
+	}
+}
+
+func TestMaxHandles(t *testing.T) {
+	client, _ := newLoopback(t)
+
+	var conns []i2c.Conn
+	for i := 0; i < DefaultMaxHandles; i++ {
+		conn, err := client.Open(0x44)
+		if err != nil {
+			t.Fatalf("open %d: %v", i, err)
+		}
+		conns = append(conns, conn)
+	}
+	if _, err := client.Open(0x44); !errors.Is(err, syscall.EMFILE) {
+		t.Fatalf("got %v, want EMFILE past %d handles", err, DefaultMaxHandles)
+	}
+
+	conns[0].Close()
+	if _, err := client.Open(0x44); err != nil {
+		t.Errorf("open once a handle is closed: %v", err)
+	}
+}
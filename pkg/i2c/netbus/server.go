@@ -0,0 +1,161 @@
+package netbus
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+
+	"dev/pkg/i2c"
+)
+
+// DefaultMaxHandles is how many connections a client can have open at once
+const DefaultMaxHandles = 32
+
+// Server exports a bus to the clients connecting to it. Each client gets its
+// own connections to the devices, which are closed when it goes away.
+type Server struct {
+	MaxHandles int // Connections a client can have open at once, opening more fails with EMFILE
+
+	bus i2c.Bus
+}
+
+// NewServer creates a server exporting bus
+func NewServer(bus i2c.Bus) *Server {
+	return &Server{MaxHandles: DefaultMaxHandles, bus: bus}
+}
+
+// ListenAndServe listens on the TCP address and serves the clients
+func (s *Server) ListenAndServe(address string) error {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts clients on l until it is closed
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	for {
+		nc, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go s.serveConn(nc)
+	}
+}
+
+// session is the state of a connected client
+type session struct {
+	bus     i2c.Bus
+	conns   map[uint32]i2c.Conn
+	handles uint32
+	max     int
+}
+
+// serveConn answers the requests of a client until it disconnects
+func (s *Server) serveConn(nc net.Conn) {
+	sess := &session{bus: s.bus, conns: make(map[uint32]i2c.Conn), max: s.MaxHandles}
+	defer func() {
+		for _, conn := range sess.conns {
+			conn.Close()
+		}
+		nc.Close()
+	}()
+
+	r := bufio.NewReader(nc)
+	w := bufio.NewWriter(nc)
+	for {
+		req, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		if err := writeFrame(w, sess.handle(req)); err != nil {
+			return
+		}
+	}
+}
+
+// handle runs a request and returns the response
+func (sess *session) handle(req []byte) []byte {
+	if len(req) == 0 {
+		return encodeError(ErrMalformed)
+	}
+	op, args := req[0], req[1:]
+
+	if op == opOpen {
+		if len(args) != 2 {
+			return encodeError(ErrMalformed)
+		}
+		if len(sess.conns) >= sess.max {
+			return encodeError(syscall.EMFILE)
+		}
+		conn, err := sess.bus.Open(binary.BigEndian.Uint16(args))
+		if err != nil {
+			return encodeError(err)
+		}
+		sess.handles++
+		sess.conns[sess.handles] = conn
+		return binary.BigEndian.AppendUint32([]byte{statusOK}, sess.handles)
+	}
+
+	if len(args) < 4 {
+		return encodeError(ErrMalformed)
+	}
+	handle := binary.BigEndian.Uint32(args)
+	conn, ok := sess.conns[handle]
+	if !ok {
+		return encodeError(syscall.EBADF)
+	}
+	args = args[4:]
+
+	switch op {
+	case opClose:
+		delete(sess.conns, handle)
+		if err := conn.Close(); err != nil {
+			return encodeError(err)
+		}
+		return []byte{statusOK}
+
+	case opRead:
+		if len(args) != 2 {
+			return encodeError(ErrMalformed)
+		}
+		buf := make([]byte, binary.BigEndian.Uint16(args))
+		n, err := conn.Read(buf)
+		if err != nil {
+			return encodeError(err)
+		}
+		return append([]byte{statusOK}, buf[:n]...)
+
+	case opWrite:
+		n, err := conn.Write(args)
+		if err != nil {
+			return encodeError(err)
+		}
+		return binary.BigEndian.AppendUint32([]byte{statusOK}, uint32(n))
+
+	case opTx:
+		if len(args) < 2 {
+			return encodeError(ErrMalformed)
+		}
+		r := make([]byte, binary.BigEndian.Uint16(args))
+		if err := conn.Tx(args[2:], r); err != nil {
+			return encodeError(err)
+		}
+		return append([]byte{statusOK}, r...)
+
+	case opFuncs:
+		caps, err := i2c.CapabilitiesOf(conn)
+		if err != nil {
+			return encodeError(err)
+		}
+		return binary.BigEndian.AppendUint32([]byte{statusOK}, caps.Funcs)
+	}
+	return encodeError(ErrMalformed)
+}
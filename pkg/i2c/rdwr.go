@@ -0,0 +1,78 @@
+package i2c
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+	"unsafe"
+)
+
+// i2c_msg flags
+const (
+	I2C_M_RD      = 0x0001 // read data, from slave to master
+	I2C_M_TEN     = 0x0010 // this is a ten bit chip address
+	I2C_M_STOP    = 0x8000 // force a STOP after this message
+	I2C_M_NOSTART = 0x4000 // do not send a (repeated) START before this message
+
+	// I2C_RDWR_IOCTL_MAX_MSGS is the kernel limit of messages per transfer
+	I2C_RDWR_IOCTL_MAX_MSGS = 42
+)
+
+// Msg is a single message of a combined transfer. Messages of a transfer
+// are separated by repeated starts, and only the last one ends with a STOP.
+type Msg struct {
+	Addr  uint16 // Slave address
+	Flags uint16 // I2C_M_* flags, I2C_M_RD for a read
+	Buf   []byte // Data to write, or buffer to read into
+}
+
+// i2cMsg mirrors struct i2c_msg from <linux/i2c.h>
+type i2cMsg struct {
+	addr  uint16
+	flags uint16
+	len   uint16
+	buf   unsafe.Pointer
+}
+
+// i2cRdwrIoctlData mirrors struct i2c_rdwr_ioctl_data from <linux/i2c-dev.h>
+type i2cRdwrIoctlData struct {
+	msgs  unsafe.Pointer
+	nmsgs uint32
+}
+
+// Transfer performs a combined transfer of several messages through the
+// I2C_RDWR ioctl. The adapter must support plain I2C (I2C_FUNC_I2C).
+func (dev *I2CDevice) Transfer(msgs ...Msg) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+	if len(msgs) > I2C_RDWR_IOCTL_MAX_MSGS {
+		return fmt.Errorf("too many messages in transfer: %d > %d", len(msgs), I2C_RDWR_IOCTL_MAX_MSGS)
+	}
+
+	raw := make([]i2cMsg, len(msgs))
+	for i, m := range msgs {
+		if len(m.Buf) > 0xFFFF {
+			return fmt.Errorf("message %d too long: %d bytes", i, len(m.Buf))
+		}
+		raw[i] = i2cMsg{
+			addr:  m.Addr,
+			flags: m.Flags,
+			len:   uint16(len(m.Buf)),
+		}
+		if len(m.Buf) > 0 {
+			raw[i].buf = unsafe.Pointer(&m.Buf[0])
+		}
+	}
+
+	data := i2cRdwrIoctlData{
+		msgs:  unsafe.Pointer(&raw[0]),
+		nmsgs: uint32(len(raw)),
+	}
+	start := time.Now()
+	err := ioctl(dev.File.Fd(), I2C_RDWR, uintptr(unsafe.Pointer(&data)))
+	runtime.KeepAlive(msgs)
+	runtime.KeepAlive(raw)
+	DefaultMetrics.ObserveTransfer(dev.busName(), msgs, time.Since(start), err)
+	return err
+}
@@ -0,0 +1,232 @@
+package i2c
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrBusLost is returned while the adapter is gone and has not come back yet
+var ErrBusLost = errors.New("i2c bus lost")
+
+// Default settings of a Reconnector
+const (
+	DefaultLostThreshold = 5
+	DefaultWatchInterval = 500 * time.Millisecond
+)
+
+// Reconnector is a Conn that survives its adapter being unplugged, as
+// happens with USB adapters. An ENODEV error or a storm of consecutive EIO
+// errors marks the bus as lost: the connection is closed, every operation
+// fails fast with ErrBusLost, and reopening it is retried until the adapter
+// comes back. The reconnect hooks then reinitialize the chip before any
+// other operation goes through.
+type Reconnector struct {
+	Threshold int           // Consecutive EIO errors before the bus is considered lost
+	Interval  time.Duration // Interval between two attempts to reopen the connection
+
+	name string
+	open func() (Conn, error)
+
+	mu       sync.Mutex
+	conn     Conn
+	errs     int
+	lost     bool
+	hooks    []func(conn Conn) error
+	watching bool
+	done     chan struct{}
+}
+
+var _ Conn = (*Reconnector)(nil)
+
+// NewReconnector opens a connection with open and reopens it the same way
+// after the bus was lost, name being used in the logs. The adapter may come
+// back under another number, which another adapter may have taken: open
+// must look it up again, as NamedAdapter does.
+func NewReconnector(name string, open func() (Conn, error)) (*Reconnector, error) {
+	conn, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &Reconnector{
+		Threshold: DefaultLostThreshold,
+		Interval:  DefaultWatchInterval,
+		name:      name,
+		open:      open,
+		conn:      conn,
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// OpenReconnecting opens the device at addr behind a Reconnector, looking
+// the adapter up again to reconnect
+func (a NamedAdapter) OpenReconnecting(addr uint16) (*Reconnector, error) {
+	return OpenReconnecting(a, addr)
+}
+
+// OpenReconnecting opens the device at addr on bus behind a Reconnector,
+// for buses wrapping a NamedAdapter
+func OpenReconnecting(bus Bus, addr uint16) (*Reconnector, error) {
+	return NewReconnector(fmt.Sprintf("device %#02x", addr), func() (Conn, error) {
+		return bus.Open(addr)
+	})
+}
+
+// OnReconnect registers a hook run after the connection has been reopened,
+// typically reinitializing the chip. The hooks run before any other
+// operation goes through the Reconnector, which is held meanwhile: they must
+// use the new connection given to them, not the Reconnector. A failing hook
+// drops the connection, which is reopened at the next attempt.
+func (r *Reconnector) OnReconnect(hook func(conn Conn) error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// Lost reports whether the bus is currently lost
+func (r *Reconnector) Lost() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lost
+}
+
+// Read reads bytes from the device
+func (r *Reconnector) Read(buf []byte) (n int, err error) {
+	err = r.do(func(c Conn) error {
+		n, err = c.Read(buf)
+		return err
+	})
+	return n, err
+}
+
+// Write writes bytes to the device
+func (r *Reconnector) Write(buf []byte) (n int, err error) {
+	err = r.do(func(c Conn) error {
+		n, err = c.Write(buf)
+		return err
+	})
+	return n, err
+}
+
+// Tx writes w then reads into r
+func (r *Reconnector) Tx(w, rd []byte) error {
+	return r.do(func(c Conn) error {
+		return c.Tx(w, rd)
+	})
+}
+
+// Capabilities returns the capabilities of the current connection
+func (r *Reconnector) Capabilities() (caps Capabilities, err error) {
+	err = r.do(func(c Conn) error {
+		caps, err = CapabilitiesOf(c)
+		return err
+	})
+	return caps, err
+}
+
+// Close stops watching the device node and closes the connection
+func (r *Reconnector) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.done:
+		return nil
+	default:
+	}
+	close(r.done)
+	if r.conn != nil {
+		return r.conn.Close()
+	}
+	return nil
+}
+
+// do runs op on the current connection and tracks the errors it returns
+func (r *Reconnector) do(op func(c Conn) error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lost {
+		return ErrBusLost
+	}
+
+	err := op(r.conn)
+	switch {
+	case err == nil:
+		r.errs = 0
+	case errors.Is(err, syscall.ENODEV):
+		r.markLost(err)
+	case errors.Is(err, syscall.EIO):
+		r.errs++
+		if r.errs >= r.Threshold {
+			r.markLost(err)
+		}
+	}
+	return err
+}
+
+// markLost closes the connection and starts watching for the device node.
+// It must be called with r.mu held.
+func (r *Reconnector) markLost(cause error) {
+	log.Printf("i2c: %s lost: %v", r.name, cause)
+	r.lost = true
+	r.conn.Close()
+	r.conn = nil
+	if !r.watching {
+		r.watching = true
+		go r.watch()
+	}
+}
+
+// watch tries to reopen the connection until it succeeds and the chip is
+// reinitialized
+func (r *Reconnector) watch() {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		}
+		conn, err := r.open()
+		if err != nil {
+			continue
+		}
+
+		r.mu.Lock()
+		select {
+		case <-r.done:
+			r.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		if err := r.reinit(conn); err != nil {
+			r.mu.Unlock()
+			log.Printf("i2c: %s reconnect hook failed: %v", r.name, err)
+			conn.Close()
+			continue
+		}
+		r.conn = conn
+		r.errs = 0
+		r.lost = false
+		r.watching = false
+		r.mu.Unlock()
+
+		log.Printf("i2c: %s is back", r.name)
+		return
+	}
+}
+
+// reinit runs the reconnect hooks on conn. It must be called with r.mu held.
+func (r *Reconnector) reinit(conn Conn) error {
+	for _, hook := range r.hooks {
+		if err := hook(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package i2c
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// unpluggableConn fails with ENODEV once its device node is gone
+type unpluggableConn struct {
+	path string
+}
+
+func (c *unpluggableConn) check() error {
+	if _, err := os.Stat(c.path); err != nil {
+		return syscall.ENODEV
+	}
+	return nil
+}
+
+func (c *unpluggableConn) Read(buf []byte) (int, error)  { return len(buf), c.check() }
+func (c *unpluggableConn) Write(buf []byte) (int, error) { return len(buf), c.check() }
+func (c *unpluggableConn) Tx(w, r []byte) error          { return c.check() }
+func (c *unpluggableConn) Close() error                  { return nil }
+
+func TestReconnector(t *testing.T) {
+	node := filepath.Join(t.TempDir(), "i2c-9")
+	if err := os.WriteFile(node, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	opens := 0
+	r, err := NewReconnector("i2c-9", func() (Conn, error) {
+		if _, err := os.Stat(node); err != nil {
+			return nil, err
+		}
+		opens++
+		return &unpluggableConn{path: node}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Interval = time.Millisecond
+
+	// The first reinit fails, the connection is then reopened
+	reinit := make(chan Conn, 2)
+	failed := false
+	r.OnReconnect(func(conn Conn) error {
+		if !failed {
+			failed = true
+			return syscall.EIO
+		}
+		if _, err := conn.Write([]byte{0x30, 0xA2}); err != nil {
+			return err
+		}
+		reinit <- conn
+		return nil
+	})
+
+	if _, err := r.Write([]byte{0x30, 0xA2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unplug the adapter
+	os.Remove(node)
+	if _, err := r.Write([]byte{0x30, 0xA2}); !errors.Is(err, syscall.ENODEV) {
+		t.Fatalf("got %v, want ENODEV", err)
+	}
+	if _, err := r.Write([]byte{0x30, 0xA2}); !errors.Is(err, ErrBusLost) {
+		t.Fatalf("got %v, want ErrBusLost", err)
+	}
+
+	// Plug it back
+	if err := os.WriteFile(node, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var conn Conn
+	select {
+	case conn = <-reinit:
+	case <-time.After(time.Second):
+		t.Fatal("reconnect hook not called")
+	}
+	// The reinit is done before the Reconnector is released
+	if r.Lost() {
+		t.Error("still lost after the reconnect hook")
+	}
+	if _, err := r.Write([]byte{0x30, 0xA2}); err != nil {
+		t.Fatal(err)
+	}
+	if r.conn != conn {
+		t.Error("hook not given the new connection")
+	}
+	if opens != 3 {
+		t.Errorf("opened %d times, want 3", opens)
+	}
+}
@@ -0,0 +1,152 @@
+package i2c
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+)
+
+// Range of addresses probed by Scan, reserved addresses excluded
+const (
+	ScanFirst = 0x03
+	ScanLast  = 0x77
+)
+
+// Bus is an I2C bus on which connections to individual devices can be opened
+type Bus interface {
+	Open(addr uint16) (Conn, error)
+}
+
+// ScopedBus is a bus whose devices can be put in a scope, such as the
+// channel of a multiplexer, so that devices sharing an address in
+// different scopes are locked apart
+type ScopedBus interface {
+	Bus
+	Scope(name string) Bus
+}
+
+// Scope returns bus with its devices in scope name, or bus itself when it
+// does not lock its devices
+func Scope(bus Bus, name string) Bus {
+	if scoped, ok := bus.(ScopedBus); ok {
+		return scoped.Scope(name)
+	}
+	return bus
+}
+
+// Adapter is a /dev/i2c-N bus
+type Adapter struct {
+	Number  int
+	Options Options // How devices are claimed, 10-bit addresses need TenBit
+}
+
+var _ ScopedBus = Adapter{}
+
+// Path returns the device node of the adapter
+func (a Adapter) Path() string {
+	return fmt.Sprintf("/dev/i2c-%d", a.Number)
+}
+
+// Open opens a connection to the device at addr on the adapter
+func (a Adapter) Open(addr uint16) (Conn, error) {
+	return InitWithOptions(a.Number, addr, a.Options)
+}
+
+// Scope returns the adapter with its devices locked in scope name, nested
+// in the current scope if any
+func (a Adapter) Scope(name string) Bus {
+	a.Options = a.Options.scoped(name)
+	return a
+}
+
+// scoped returns the options with the lock scope name nested in the current one
+func (o Options) scoped(name string) Options {
+	if o.LockScope != "" {
+		name = o.LockScope + "-" + name
+	}
+	o.LockScope = name
+	return o
+}
+
+// Scan probes every address between ScanFirst and ScanLast and returns the
+// ones a device answered on. Like i2cdetect, it uses a quick write except
+// in the 0x30-0x37 and 0x50-0x5F ranges where a read byte is safer (these
+// are usually EEPROMs that a quick write could corrupt). Addresses that are
+// already claimed by a kernel driver are reported as present.
+func Scan(bus Bus) ([]uint16, error) {
+	var found []uint16
+	for addr := uint16(ScanFirst); addr <= ScanLast; addr++ {
+		conn, err := bus.Open(addr)
+		if errors.Is(err, syscall.EBUSY) {
+			found = append(found, addr)
+			continue
+		}
+		if err != nil {
+			return found, fmt.Errorf("open %#02x: %w", addr, err)
+		}
+		if probe(conn, addr) == nil {
+			found = append(found, addr)
+		}
+		conn.Close()
+	}
+	return found, nil
+}
+
+// probe checks whether a device acknowledges its address
+func probe(conn Conn, addr uint16) error {
+	useRead := (addr >= 0x30 && addr <= 0x37) || (addr >= 0x50 && addr <= 0x5F)
+	if capable, ok := conn.(Capable); ok {
+		if caps, err := capable.Capabilities(); err == nil && !caps.SMBusQuick {
+			useRead = true
+		}
+	}
+
+	smbus, ok := conn.(SMBus)
+	switch {
+	case useRead && ok:
+		_, err := smbus.ReadByte()
+		return err
+	case useRead:
+		_, err := conn.Read(make([]byte, 1))
+		return err
+	case ok:
+		return smbus.WriteQuick(I2C_SMBUS_WRITE)
+	default:
+		_, err := conn.Write(nil)
+		return err
+	}
+}
+
+// PrintGrid writes the addresses found by Scan in the familiar i2cdetect layout
+func PrintGrid(w io.Writer, found []uint16) {
+	present := make(map[uint16]bool, len(found))
+	for _, addr := range found {
+		present[addr] = true
+	}
+
+	fmt.Fprint(w, "    ")
+	for col := 0; col < 16; col++ {
+		fmt.Fprintf(w, "  %x", col)
+	}
+	fmt.Fprintln(w)
+
+	for row := uint16(0); row < 0x80; row += 16 {
+		fmt.Fprintf(w, "%02x:", row)
+		for col := uint16(0); col < 16; col++ {
+			addr := row + col
+			if addr > ScanLast {
+				break
+			}
+			switch {
+			case addr < ScanFirst:
+				fmt.Fprint(w, "   ")
+			case present[addr]:
+				fmt.Fprintf(w, " %02x", addr)
+			default:
+				fmt.Fprint(w, " --")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+}
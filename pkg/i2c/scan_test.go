@@ -0,0 +1,58 @@
+package i2c
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeBus answers on a fixed set of addresses
+type fakeBus map[uint16]bool
+
+type fakeConn struct {
+	present bool
+}
+
+func (b fakeBus) Open(addr uint16) (Conn, error) {
+	return &fakeConn{present: b[addr]}, nil
+}
+
+func (c *fakeConn) result() error {
+	if !c.present {
+		return errors.New("nack")
+	}
+	return nil
+}
+
+func (c *fakeConn) Read(buf []byte) (int, error)  { return len(buf), c.result() }
+func (c *fakeConn) Write(buf []byte) (int, error) { return len(buf), c.result() }
+func (c *fakeConn) Tx(w, r []byte) error          { return c.result() }
+func (c *fakeConn) Close() error                  { return nil }
+
+func TestScan(t *testing.T) {
+	bus := fakeBus{0x01: true, 0x3c: true, 0x44: true, 0x50: true, 0x78: true}
+	found, err := Scan(bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uint16{0x3c, 0x44, 0x50}
+	if len(found) != len(want) {
+		t.Fatalf("found %x, want %x", found, want)
+	}
+	for i := range want {
+		if found[i] != want[i] {
+			t.Fatalf("found %x, want %x", found, want)
+		}
+	}
+
+	var out bytes.Buffer
+	PrintGrid(&out, found)
+	lines := strings.Split(out.String(), "\n")
+	if got := lines[4]; got != "30: -- -- -- -- -- -- -- -- -- -- -- -- 3c -- -- --" {
+		t.Errorf("unexpected grid row %q", got)
+	}
+	if got := lines[8]; got != "70: -- -- -- -- -- -- -- --" {
+		t.Errorf("unexpected grid row %q", got)
+	}
+}
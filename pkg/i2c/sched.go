@@ -0,0 +1,249 @@
+package i2c
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Priority of a connection sharing a bus through a Scheduler
+type Priority int
+
+const (
+	PriorityLow    Priority = iota // Bulk transfers such as display frames
+	PriorityNormal                 // Default
+	PriorityHigh                   // Latency sensitive transfers such as sensor reads
+)
+
+// DefaultMaxHold is how long a connection can hold the bus while others wait
+const DefaultMaxHold = 5 * time.Millisecond
+
+// Scheduler serializes the transactions of several connections sharing a
+// physical bus. When the bus is busy, the waiting connection with the
+// highest priority gets it next, in arrival order for equal priorities.
+type Scheduler struct {
+	MaxHold time.Duration // Longest a Hold keeps the bus while others wait
+
+	mu      sync.Mutex
+	busy    bool
+	waiters []*schedWaiter
+}
+
+type schedWaiter struct {
+	prio  Priority
+	ready chan struct{}
+}
+
+// SchedConn is a connection whose transactions go through a Scheduler
+type SchedConn struct {
+	conn  Conn
+	sched *Scheduler
+	prio  Priority
+
+	mu    sync.Mutex
+	held  bool
+	since time.Time
+}
+
+var (
+	_ Conn        = (*SchedConn)(nil)
+	_ ContextConn = (*SchedConn)(nil)
+)
+
+// Holder is implemented by connections that can keep the bus across several
+// transactions, such as SchedConn
+type Holder interface {
+	Hold()
+	Release()
+}
+
+var _ Holder = (*SchedConn)(nil)
+
+// Hold keeps the bus of c, if it can be kept, and returns the function
+// giving it back. Drivers use it around bulk transfers such as display
+// frames.
+func Hold(c Conn) (release func()) {
+	holder, ok := c.(Holder)
+	if !ok {
+		return func() {}
+	}
+	holder.Hold()
+	return holder.Release
+}
+
+// NewScheduler creates a scheduler, with DefaultMaxHold as hold cap
+func NewScheduler() *Scheduler {
+	return &Scheduler{MaxHold: DefaultMaxHold}
+}
+
+// Wrap returns a connection scheduling the transactions of conn at the
+// given priority
+func (s *Scheduler) Wrap(conn Conn, prio Priority) *SchedConn {
+	return &SchedConn{conn: conn, sched: s, prio: prio}
+}
+
+// acquire waits for the bus, until ctx is done
+func (s *Scheduler) acquire(ctx context.Context, prio Priority) error {
+	s.mu.Lock()
+	if !s.busy {
+		s.busy = true
+		s.mu.Unlock()
+		return nil
+	}
+	w := &schedWaiter{prio: prio, ready: make(chan struct{})}
+	i := sort.Search(len(s.waiters), func(i int) bool {
+		return s.waiters[i].prio < prio
+	})
+	s.waiters = append(s.waiters, nil)
+	copy(s.waiters[i+1:], s.waiters[i:])
+	s.waiters[i] = w
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.waiters {
+		if s.waiters[i] == w {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			return ctx.Err()
+		}
+	}
+	// The bus was handed over meanwhile, pass it on
+	s.handOver()
+	return ctx.Err()
+}
+
+// release hands the bus over to the first waiter
+func (s *Scheduler) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handOver()
+}
+
+// handOver gives the bus to the first waiter, s.mu being held
+func (s *Scheduler) handOver() {
+	if len(s.waiters) == 0 {
+		s.busy = false
+		return
+	}
+	w := s.waiters[0]
+	s.waiters = s.waiters[1:]
+	close(w.ready)
+}
+
+// contended reports whether someone is waiting for the bus
+func (s *Scheduler) contended() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.waiters) > 0
+}
+
+// Hold keeps the bus across several transactions, e.g. for a display frame,
+// until Release. If others are waiting once MaxHold has elapsed, the bus is
+// handed over to them between two transactions and taken back afterwards.
+func (c *SchedConn) Hold() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.held {
+		return
+	}
+	c.sched.acquire(context.Background(), c.prio)
+	c.held = true
+	c.since = time.Now()
+}
+
+// Release gives back a bus kept by Hold
+func (c *SchedConn) Release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.held {
+		return
+	}
+	c.held = false
+	c.sched.release()
+}
+
+// do runs a transaction while owning the bus, unless ctx is done before
+// the bus is
+func (c *SchedConn) do(ctx context.Context, op func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.held {
+		if err := c.sched.acquire(ctx, c.prio); err != nil {
+			return err
+		}
+		defer c.sched.release()
+		return op()
+	}
+
+	if time.Since(c.since) >= c.sched.MaxHold && c.sched.contended() {
+		c.sched.release()
+		if err := c.sched.acquire(ctx, c.prio); err != nil {
+			c.held = false
+			return err
+		}
+		c.since = time.Now()
+	}
+	return op()
+}
+
+// Read reads bytes from the device
+func (c *SchedConn) Read(buf []byte) (int, error) {
+	return c.ReadContext(context.Background(), buf)
+}
+
+// Write writes bytes to the device
+func (c *SchedConn) Write(buf []byte) (int, error) {
+	return c.WriteContext(context.Background(), buf)
+}
+
+// Tx writes w then reads into r
+func (c *SchedConn) Tx(w, r []byte) error {
+	return c.TxContext(context.Background(), w, r)
+}
+
+// ReadContext reads bytes from the device, giving up waiting for the bus
+// when ctx is done
+func (c *SchedConn) ReadContext(ctx context.Context, buf []byte) (n int, err error) {
+	err = c.do(ctx, func() error {
+		n, err = ReadContext(ctx, c.conn, buf)
+		return err
+	})
+	return n, err
+}
+
+// WriteContext writes bytes to the device, giving up waiting for the bus
+// when ctx is done
+func (c *SchedConn) WriteContext(ctx context.Context, buf []byte) (n int, err error) {
+	err = c.do(ctx, func() error {
+		n, err = WriteContext(ctx, c.conn, buf)
+		return err
+	})
+	return n, err
+}
+
+// TxContext writes w then reads into r, giving up waiting for the bus when
+// ctx is done
+func (c *SchedConn) TxContext(ctx context.Context, w, r []byte) error {
+	return c.do(ctx, func() error {
+		return TxContext(ctx, c.conn, w, r)
+	})
+}
+
+// Close releases the bus if held and closes the connection
+func (c *SchedConn) Close() error {
+	c.Release()
+	return c.conn.Close()
+}
+
+// Capabilities returns the capabilities of the wrapped connection
+func (c *SchedConn) Capabilities() (Capabilities, error) {
+	return CapabilitiesOf(c.conn)
+}
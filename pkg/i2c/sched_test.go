@@ -0,0 +1,171 @@
+package i2c
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// orderLog records which connection ran each transaction
+type orderLog struct {
+	mu  sync.Mutex
+	ops []string
+}
+
+func (l *orderLog) add(name string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ops = append(l.ops, name)
+}
+
+func (l *orderLog) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.ops, " ")
+}
+
+// loggedConn logs its transactions under a name
+type loggedConn struct {
+	fakeConn
+	name string
+	log  *orderLog
+}
+
+func (c *loggedConn) Write(buf []byte) (int, error) {
+	c.log.add(c.name)
+	return len(buf), nil
+}
+
+func (c *loggedConn) Tx(w, r []byte) error {
+	c.log.add(c.name)
+	return nil
+}
+
+// waitQueued waits until n connections wait for the bus
+func waitQueued(s *Scheduler, n int) {
+	for {
+		s.mu.Lock()
+		queued := len(s.waiters)
+		s.mu.Unlock()
+		if queued == n {
+			return
+		}
+		runtime.Gosched()
+	}
+}
+
+// goTx runs a transaction on c in the background, done being closed after it
+func goTx(c *SchedConn) (done chan struct{}) {
+	done = make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Tx([]byte{0xF3, 0x2D}, make([]byte, 3))
+	}()
+	return done
+}
+
+func TestSchedulerPriority(t *testing.T) {
+	log := &orderLog{}
+	sched := NewScheduler()
+	wrap := func(name string, prio Priority) *SchedConn {
+		return sched.Wrap(&loggedConn{fakeConn{present: true}, name, log}, prio)
+	}
+	display := wrap("display", PriorityLow)
+	low := wrap("low", PriorityLow)
+	high := wrap("high", PriorityHigh)
+
+	// Waiters are served by priority once the bus is given back
+	display.Hold()
+	lowDone := goTx(low)
+	waitQueued(sched, 1)
+	highDone := goTx(high)
+	waitQueued(sched, 2)
+	display.Release()
+	<-lowDone
+	<-highDone
+	if got := log.String(); got != "high low" {
+		t.Errorf("got %q, want the high priority transaction first", got)
+	}
+}
+
+func TestSchedulerMaxHold(t *testing.T) {
+	log := &orderLog{}
+	sched := NewScheduler()
+	display := sched.Wrap(&loggedConn{fakeConn{present: true}, "display", log}, PriorityLow)
+	sensor := sched.Wrap(&loggedConn{fakeConn{present: true}, "sensor", log}, PriorityHigh)
+
+	// Within MaxHold, a held bus is kept until released
+	sched.MaxHold = 1 << 62
+	display.Hold()
+	done := goTx(sensor)
+	waitQueued(sched, 1)
+	display.Write([]byte{0x40, 0xFF})
+	display.Write([]byte{0x40, 0xFF})
+	display.Release()
+	<-done
+	if got := log.String(); got != "display display sensor" {
+		t.Errorf("got %q, want the frame kept together", got)
+	}
+
+	// Past MaxHold, the waiter goes between two transactions of the frame
+	log.ops = nil
+	sched.MaxHold = 0
+	display.Hold()
+	done = goTx(sensor)
+	waitQueued(sched, 1)
+	display.Write([]byte{0x40, 0xFF})
+	<-done
+	display.Write([]byte{0x40, 0xFF})
+	display.Release()
+	if got := log.String(); got != "sensor display display" {
+		t.Errorf("got %q, want the sensor read ahead of the frame", got)
+	}
+}
+
+func TestHold(t *testing.T) {
+	sched := NewScheduler()
+	conn := sched.Wrap(&fakeConn{present: true}, PriorityLow)
+	release := Hold(conn)
+	if !conn.held {
+		t.Error("bus not held")
+	}
+	release()
+	if conn.held {
+		t.Error("bus not released")
+	}
+
+	// Connections that cannot hold the bus are left alone
+	Hold(&fakeConn{present: true})()
+}
+
+func TestSchedulerContext(t *testing.T) {
+	sched := NewScheduler()
+	log := &orderLog{}
+	display := sched.Wrap(&loggedConn{fakeConn{present: true}, "display", log}, PriorityLow)
+	sensor := sched.Wrap(&loggedConn{fakeConn{present: true}, "sensor", log}, PriorityHigh)
+
+	release := Hold(display)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- TxContext(ctx, sensor, []byte{0x24, 0x00}, make([]byte, 6))
+	}()
+	waitQueued(sched, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want Canceled while waiting for the bus", err)
+	}
+	waitQueued(sched, 0)
+	release()
+
+	// The bus is free again once the waiter gave up
+	if err := sensor.Tx([]byte{0x24, 0x00}, make([]byte, 6)); err != nil {
+		t.Fatal(err)
+	}
+	if got := log.String(); got != "sensor" {
+		t.Errorf("got transactions %q, want the second sensor read only", got)
+	}
+}
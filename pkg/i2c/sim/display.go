@@ -0,0 +1,232 @@
+package sim
+
+import (
+	"image"
+	"image/color"
+	"sync"
+)
+
+// Controller selects the command set understood by a Display model
+type Controller int
+
+const (
+	SSD1306 Controller = iota // 128x64, horizontal or page addressing
+	SH1107                    // 128x128, page addressing
+)
+
+// OLED control bytes
+const (
+	controlCo   = 0x80 // Continuation bit: a single byte follows
+	controlData = 0x40 // D/C# bit: data, command otherwise
+)
+
+// Display models the GDDRAM and command parser of an SSD1306 or SH1107 OLED
+// controller driven over I2C
+type Display struct {
+	mu         sync.Mutex
+	controller Controller
+	w, h       int
+	ram        []byte // GDDRAM, one byte per column and page
+
+	on       bool
+	inverted bool
+	contrast byte
+
+	horizontal bool // SSD1306 horizontal addressing mode
+	page, col  int
+	colStart   int
+	colEnd     int
+	pageStart  int
+	pageEnd    int
+
+	cmd  []byte // Command waiting for its arguments
+	args int
+}
+
+var _ Device = (*Display)(nil)
+
+// NewDisplay creates a display model in its reset state
+func NewDisplay(controller Controller) *Display {
+	d := &Display{controller: controller, w: 128, h: 64, contrast: 0x7F}
+	if controller == SH1107 {
+		d.h = 128
+	}
+	d.ram = make([]byte, d.w*d.h/8)
+	d.colEnd = d.w - 1
+	d.pageEnd = d.h/8 - 1
+	return d
+}
+
+// On reports whether the display is on
+func (d *Display) On() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.on
+}
+
+// Contrast returns the current contrast setting
+func (d *Display) Contrast() byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.contrast
+}
+
+// GDDRAM returns a copy of the display RAM, page after page
+func (d *Display) GDDRAM() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]byte(nil), d.ram...)
+}
+
+// Image dumps the display RAM as an image, bit n of a byte of page p being
+// the pixel of row 8*p+n
+func (d *Display) Image() *image.Gray {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	img := image.NewGray(image.Rect(0, 0, d.w, d.h))
+	for y := 0; y < d.h; y++ {
+		for x := 0; x < d.w; x++ {
+			on := d.ram[(y/8)*d.w+x]&(1<<(y%8)) != 0
+			if on != d.inverted {
+				img.SetGray(x, y, color.Gray{Y: 0xFF})
+			}
+		}
+	}
+	return img
+}
+
+// Write parses a control byte stream
+func (d *Display) Write(data []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for len(data) > 0 {
+		control := data[0]
+		data = data[1:]
+		payload := data
+		if control&controlCo != 0 && len(data) > 0 {
+			payload = data[:1]
+		}
+		data = data[len(payload):]
+
+		for _, b := range payload {
+			if control&controlData != 0 {
+				d.writeRAM(b)
+			} else {
+				d.command(b)
+			}
+		}
+	}
+	return nil
+}
+
+// Read returns the status byte, display off flag in bit 6. The other bits
+// are left clear, how the controllers set them is not modelled.
+func (d *Display) Read(buf []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var status byte
+	if !d.on {
+		status |= 0x40
+	}
+	for i := range buf {
+		buf[i] = status
+	}
+	return nil
+}
+
+// writeRAM stores a data byte and advances the column address
+func (d *Display) writeRAM(b byte) {
+	if d.page < d.h/8 && d.col < d.w {
+		d.ram[d.page*d.w+d.col] = b
+	}
+	if !d.horizontal {
+		if d.col < d.w-1 {
+			d.col++
+		}
+		return
+	}
+	d.col++
+	if d.col > d.colEnd {
+		d.col = d.colStart
+		d.page++
+		if d.page > d.pageEnd {
+			d.page = d.pageStart
+		}
+	}
+}
+
+// argCount returns how many argument bytes follow a command
+func (d *Display) argCount(cmd byte) int {
+	switch cmd {
+	case 0x81, 0xA8, 0xD3, 0xD5, 0xD9, 0xDA, 0xDB:
+		return 1
+	}
+	if d.controller == SH1107 {
+		switch cmd {
+		case 0xAD, 0xDC:
+			return 1
+		}
+		return 0
+	}
+	switch cmd {
+	case 0x20, 0x8D:
+		return 1
+	case 0x21, 0x22:
+		return 2
+	}
+	return 0
+}
+
+// command accumulates a command byte and runs the command once complete
+func (d *Display) command(b byte) {
+	if d.cmd == nil {
+		d.args = d.argCount(b)
+	} else {
+		d.args--
+	}
+	d.cmd = append(d.cmd, b)
+	if d.args > 0 {
+		return
+	}
+	cmd := d.cmd
+	d.cmd = nil
+	d.run(cmd)
+}
+
+// run executes a complete command
+func (d *Display) run(cmd []byte) {
+	pageMask := byte(0x07)
+	if d.controller == SH1107 {
+		pageMask = 0x0F
+	}
+
+	switch op := cmd[0]; {
+	case op == 0xAE:
+		d.on = false
+	case op == 0xAF:
+		d.on = true
+	case op == 0xA6:
+		d.inverted = false
+	case op == 0xA7:
+		d.inverted = true
+	case op == 0x81:
+		d.contrast = cmd[1]
+	case op <= 0x0F:
+		d.col = d.col&0xF0 | int(op&0x0F)
+	case op >= 0x10 && op <= 0x17:
+		d.col = d.col&0x0F | int(op&0x07)<<4
+	case op&0xF0 == 0xB0 && op&0x0F <= pageMask:
+		d.page = int(op & pageMask)
+	case d.controller == SSD1306 && op == 0x20:
+		d.horizontal = cmd[1] == 0x00
+	case d.controller == SSD1306 && op == 0x21:
+		d.colStart, d.colEnd = int(cmd[1]), int(cmd[2])
+		d.col = d.colStart
+	case d.controller == SSD1306 && op == 0x22:
+		d.pageStart, d.pageEnd = int(cmd[1]&pageMask), int(cmd[2]&pageMask)
+		d.page = d.pageStart
+	}
+}
@@ -0,0 +1,287 @@
+package sim
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// SHT31 status register bits
+const (
+	sht31StatusAlert   = 1 << 15
+	sht31StatusHeater  = 1 << 13
+	sht31StatusRHAlert = 1 << 11
+	sht31StatusTAlert  = 1 << 10
+	sht31StatusReset   = 1 << 4
+	sht31StatusCmd     = 1 << 1
+	sht31StatusCRC     = 1 << 0
+)
+
+// sht31Periods are the measurement periods of the periodic mode commands, in
+// every repeatability
+var sht31Periods = map[uint16]time.Duration{
+	0x2032: 2 * time.Second, 0x2024: 2 * time.Second, 0x202F: 2 * time.Second,
+	0x2130: time.Second, 0x2126: time.Second, 0x212D: time.Second,
+	0x2236: 500 * time.Millisecond, 0x2220: 500 * time.Millisecond, 0x222B: 500 * time.Millisecond,
+	0x2334: 250 * time.Millisecond, 0x2322: 250 * time.Millisecond, 0x2329: 250 * time.Millisecond,
+	0x2737: 100 * time.Millisecond, 0x2721: 100 * time.Millisecond, 0x272A: 100 * time.Millisecond,
+	0x2B32: 250 * time.Millisecond, // ART
+}
+
+// Alert limit commands, in the order of the SHT31 limits field
+var (
+	sht31ReadLimit  = []uint16{0xE11F, 0xE114, 0xE109, 0xE102}
+	sht31WriteLimit = []uint16{0x611D, 0x6116, 0x610B, 0x6100}
+)
+
+// sht31DefaultLimits are the alert limits after power-up: high set 80 %RH
+// 60 °C, high clear 79 %RH 58 °C, low clear 22 %RH -9 °C, low set 20 %RH
+// -10 °C
+var sht31DefaultLimits = [4]uint16{0xCD33, 0xC92D, 0x3869, 0x3466}
+
+// SHT31 models a Sensirion SHT31 humidity and temperature sensor
+type SHT31 struct {
+	mu          sync.Mutex
+	temperature float64
+	humidity    float64
+	status      uint16
+	serial      uint32
+	pending     []byte // Response to the next read
+
+	limits [4]uint16 // Alert limits: high set, high clear, low clear, low set
+
+	period time.Duration // Periodic mode measurement period, 0 in single shot mode
+	ready  time.Time     // When the next periodic measurement is available
+}
+
+// DefaultSHT31Serial is the serial number of a new SHT31 model
+const DefaultSHT31Serial = 0x0C5A1F37
+
+var _ Device = (*SHT31)(nil)
+
+// NewSHT31 creates a sensor model reporting the given conditions, in the
+// state it is in after power-up
+func NewSHT31(temperature, humidity float64) *SHT31 {
+	return &SHT31{
+		temperature: temperature,
+		humidity:    humidity,
+		status:      sht31StatusAlert | sht31StatusReset,
+		serial:      DefaultSHT31Serial,
+		limits:      sht31DefaultLimits,
+	}
+}
+
+// SetSerial changes the serial number of the sensor
+func (s *SHT31) SetSerial(serial uint32) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.serial = serial
+}
+
+// Set changes the conditions measured by the sensor
+func (s *SHT31) Set(temperature, humidity float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.temperature = temperature
+	s.humidity = humidity
+}
+
+// Status returns the raw status register
+func (s *SHT31) Status() uint16 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Periodic reports whether the sensor is in periodic mode
+func (s *SHT31) Periodic() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.period != 0
+}
+
+// Heater reports whether the heater is on
+func (s *SHT31) Heater() bool {
+	return s.Status()&sht31StatusHeater != 0
+}
+
+// Write handles a 16-bit command
+func (s *SHT31) Write(data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(data) == 0 {
+		return nil // Quick write, the address is acknowledged
+	}
+	if len(data) == 5 {
+		return s.writeLimit(data)
+	}
+	if len(data) != 2 {
+		s.status |= sht31StatusCmd
+		return ErrNACK
+	}
+	s.pending = nil
+	command := uint16(data[0])<<8 | uint16(data[1])
+	if command != 0xF32D {
+		s.status &^= sht31StatusCmd // The status read reports on the previous command
+	}
+
+	// Only a few commands are accepted in periodic mode
+	if s.period != 0 {
+		switch command {
+		case 0xE000: // Fetch data, NACKed on read until a measurement is done
+			if now := time.Now(); !now.Before(s.ready) {
+				t, rh := s.raw()
+				s.checkAlerts(t, rh) // Limits are only evaluated in periodic mode
+				s.pending = crcWords(t, rh)
+				for !s.ready.After(now) {
+					s.ready = s.ready.Add(s.period)
+				}
+			}
+			return nil
+		case 0x3093: // Break
+			s.period = 0
+			return nil
+		case 0xF32D, 0x3041, 0x30A2, 0x306D, 0x3066, 0xE11F, 0xE114, 0xE109, 0xE102:
+		default:
+			s.status |= sht31StatusCmd
+			return ErrNACK
+		}
+	}
+
+	if period, ok := sht31Periods[command]; ok {
+		s.period = period
+		s.ready = time.Now().Add(period)
+		return nil
+	}
+
+	for i, read := range sht31ReadLimit {
+		if command == read {
+			s.pending = crcWords(s.limits[i])
+			return nil
+		}
+	}
+
+	switch command {
+	case 0x2400, 0x240B, 0x2416, 0x2C06, 0x2C0D, 0x2C10: // Single shot measurement
+		s.pending = crcWords(s.raw())
+	case 0xE000: // Fetch data, there is none in single shot mode
+	case 0x3093: // Break, nothing to stop
+	case 0xF32D: // Read status
+		s.pending = crcWords(s.status)
+	case 0x3780, 0x3682: // Read serial number
+		s.pending = crcWords(uint16(s.serial>>16), uint16(s.serial))
+	case 0x3041: // Clear status
+		s.status &^= sht31StatusAlert | sht31StatusRHAlert | sht31StatusTAlert | sht31StatusReset
+	case 0x30A2: // Soft reset
+		s.status = sht31StatusAlert | sht31StatusReset
+		s.period = 0
+		s.limits = sht31DefaultLimits
+	case 0x306D: // Heater enable
+		s.status |= sht31StatusHeater
+	case 0x3066: // Heater disable
+		s.status &^= sht31StatusHeater
+	default:
+		s.status |= sht31StatusCmd
+		return ErrNACK
+	}
+	return nil
+}
+
+// Read returns the response of the last command, the sensor NACKs the read
+// header when there is nothing to read
+func (s *SHT31) Read(buf []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == nil {
+		return ErrNACK
+	}
+	n := copy(buf, s.pending)
+	for i := n; i < len(buf); i++ {
+		buf[i] = 0xFF // SDA is left high past the end of the data
+	}
+	s.pending = nil
+	return nil
+}
+
+// writeLimit handles the write of an alert limit: a command followed by
+// the limit and its CRC. A wrong CRC sets the checksum status bit and the
+// limit is left alone.
+func (s *SHT31) writeLimit(data []byte) error {
+	command := uint16(data[0])<<8 | uint16(data[1])
+	for i, write := range sht31WriteLimit {
+		if command != write {
+			continue
+		}
+		if crc8(data[2:4]) != data[4] {
+			s.status |= sht31StatusCRC
+			return nil
+		}
+		s.status &^= sht31StatusCRC | sht31StatusCmd
+		s.limits[i] = uint16(data[2])<<8 | uint16(data[3])
+		return nil
+	}
+	s.status |= sht31StatusCmd
+	return ErrNACK
+}
+
+// raw converts the current conditions to the words of a measurement
+func (s *SHT31) raw() (t, rh uint16) {
+	t = uint16(clamp(math.Round((s.temperature+45)/175*65535), 0, 65535))
+	rh = uint16(clamp(math.Round(s.humidity/100*65535), 0, 65535))
+	return t, rh
+}
+
+// checkAlerts updates the alert bits of the status from a periodic
+// measurement. An alert is raised past a set limit and cleared back within
+// the clear ones. Like the sensor, single shot measurements leave the alert
+// bits alone.
+func (s *SHT31) checkAlerts(t, rh uint16) {
+	limitRH := func(i int) uint16 { return s.limits[i] & 0xFE00 }
+	limitT := func(i int) uint16 { return (s.limits[i] & 0x01FF) << 7 }
+
+	update := func(bit uint16, v uint16, limit func(int) uint16) {
+		switch {
+		case v >= limit(0) || v <= limit(3):
+			if s.status&bit == 0 {
+				s.status |= bit | sht31StatusAlert
+			}
+		case v < limit(1) && v > limit(2):
+			s.status &^= bit
+		}
+	}
+	update(sht31StatusRHAlert, rh, limitRH)
+	update(sht31StatusTAlert, t, limitT)
+}
+
+func clamp(v, lo, hi float64) float64 {
+	return math.Max(lo, math.Min(hi, v))
+}
+
+// crcWords encodes big-endian words each followed by its CRC, as Sensirion
+// sensors do
+func crcWords(words ...uint16) []byte {
+	var out []byte
+	for _, w := range words {
+		b := []byte{byte(w >> 8), byte(w)}
+		out = append(out, b[0], b[1], crc8(b))
+	}
+	return out
+}
+
+// crc8 is the Sensirion CRC: polynomial 0x31, init 0xFF
+func crc8(data []byte) uint8 {
+	var crc uint8 = 0xFF
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x31
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
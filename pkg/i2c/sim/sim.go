@@ -0,0 +1,135 @@
+// Package sim provides an in-memory I2C bus on which device models can be
+// attached, so that drivers can run without any hardware.
+package sim
+
+import (
+	"fmt"
+	"sync"
+	"syscall"
+
+	"dev/pkg/i2c"
+)
+
+// ErrNACK is returned when no device acknowledges a transfer, like the
+// kernel does for a real adapter
+var ErrNACK = syscall.ENXIO
+
+// Device is a model of an I2C chip attached to a simulated bus
+type Device interface {
+	// Write is called with the payload of a write message
+	Write(data []byte) error
+	// Read fills buf with the payload of a read message
+	Read(buf []byte) error
+}
+
+// Bus is a simulated I2C bus
+type Bus struct {
+	mu      sync.Mutex
+	devices map[uint16]Device
+}
+
+var _ i2c.Bus = (*Bus)(nil)
+
+// Conn is a connection to an address of a simulated bus
+type Conn struct {
+	bus  *Bus
+	addr uint16
+}
+
+var _ i2c.Conn = (*Conn)(nil)
+
+// NewBus creates an empty simulated bus
+func NewBus() *Bus {
+	return &Bus{devices: make(map[uint16]Device)}
+}
+
+// Attach adds a device model at the given address
+func (b *Bus) Attach(addr uint16, dev Device) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.devices[addr] = dev
+}
+
+// Detach removes the device model at the given address
+func (b *Bus) Detach(addr uint16) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.devices, addr)
+}
+
+// Open returns a connection to addr. Like on a real bus, opening an address
+// nobody answers on succeeds and the transfers fail.
+func (b *Bus) Open(addr uint16) (i2c.Conn, error) {
+	if addr > 0x3FF {
+		return nil, fmt.Errorf("invalid address %#x", addr)
+	}
+	return &Conn{bus: b, addr: addr}, nil
+}
+
+// device returns the model at addr, the bus lock must be held. Devices
+// behind a multiplexer answer when their channel is enabled.
+func (b *Bus) device(addr uint16) (Device, error) {
+	if dev, ok := b.devices[addr]; ok {
+		return dev, nil
+	}
+	for _, dev := range b.devices {
+		if mux, ok := dev.(*TCA9548A); ok {
+			if routed := mux.route(addr); routed != nil {
+				return routed, nil
+			}
+		}
+	}
+	return nil, ErrNACK
+}
+
+// Read reads bytes from the device
+func (c *Conn) Read(buf []byte) (int, error) {
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+	dev, err := c.bus.device(c.addr)
+	if err != nil {
+		return 0, err
+	}
+	if err := dev.Read(buf); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// Write writes bytes to the device
+func (c *Conn) Write(buf []byte) (int, error) {
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+	dev, err := c.bus.device(c.addr)
+	if err != nil {
+		return 0, err
+	}
+	if err := dev.Write(buf); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+// Tx writes w then reads into r without releasing the bus in between
+func (c *Conn) Tx(w, r []byte) error {
+	c.bus.mu.Lock()
+	defer c.bus.mu.Unlock()
+	dev, err := c.bus.device(c.addr)
+	if err != nil {
+		return err
+	}
+	if len(w) > 0 {
+		if err := dev.Write(w); err != nil {
+			return err
+		}
+	}
+	if len(r) > 0 {
+		return dev.Read(r)
+	}
+	return nil
+}
+
+// Close does nothing, the simulated bus has no resources to release
+func (c *Conn) Close() error {
+	return nil
+}
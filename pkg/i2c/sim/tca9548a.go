@@ -0,0 +1,82 @@
+package sim
+
+import "sync"
+
+// TCA9548A is a model of the 8-channel I2C multiplexer. Its control
+// register enables the downstream channels, each being a bus of its own on
+// which the devices answer as if they were on the upstream bus.
+type TCA9548A struct {
+	mu       sync.Mutex
+	control  byte
+	switches int
+	channels [8]*Bus
+}
+
+var _ Device = (*TCA9548A)(nil)
+
+// NewTCA9548A creates a multiplexer with all its channels disabled
+func NewTCA9548A() *TCA9548A {
+	m := &TCA9548A{}
+	for i := range m.channels {
+		m.channels[i] = NewBus()
+	}
+	return m
+}
+
+// Channel returns the downstream bus of channel n, to attach devices on
+func (m *TCA9548A) Channel(n int) *Bus {
+	return m.channels[n]
+}
+
+// Control returns the control register, one bit per enabled channel
+func (m *TCA9548A) Control() byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.control
+}
+
+// Switches returns the number of writes to the control register
+func (m *TCA9548A) Switches() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.switches
+}
+
+// Write sets the control register to the last byte written
+func (m *TCA9548A) Write(data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(data) > 0 {
+		m.control = data[len(data)-1]
+		m.switches++
+	}
+	return nil
+}
+
+// Read returns the control register
+func (m *TCA9548A) Read(buf []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range buf {
+		buf[i] = m.control
+	}
+	return nil
+}
+
+// route returns the device answering at addr on the enabled channels
+func (m *TCA9548A) route(addr uint16) Device {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, ch := range m.channels {
+		if m.control&(1<<i) == 0 {
+			continue
+		}
+		ch.mu.Lock()
+		dev, err := ch.device(addr)
+		ch.mu.Unlock()
+		if err == nil {
+			return dev
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package i2c
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// SMBus ioctl and transaction types from <linux/i2c.h> and <linux/i2c-dev.h>
+const (
+	I2C_SMBUS = 0x0720
+
+	I2C_SMBUS_READ  = 1
+	I2C_SMBUS_WRITE = 0
+
+	I2C_SMBUS_QUICK            = 0
+	I2C_SMBUS_BYTE             = 1
+	I2C_SMBUS_BYTE_DATA        = 2
+	I2C_SMBUS_WORD_DATA        = 3
+	I2C_SMBUS_PROC_CALL        = 4
+	I2C_SMBUS_BLOCK_DATA       = 5
+	I2C_SMBUS_I2C_BLOCK_BROKEN = 6
+	I2C_SMBUS_BLOCK_PROC_CALL  = 7
+	I2C_SMBUS_I2C_BLOCK_DATA   = 8
+
+	I2C_SMBUS_BLOCK_MAX = 32 // As specified in SMBus standard
+)
+
+// ErrPEC is returned when the packet error code of an SMBus reply is wrong
+var ErrPEC = errors.New("i2c: SMBus PEC mismatch")
+
+// SMBus is implemented by connections that can issue SMBus transactions.
+type SMBus interface {
+	WriteQuick(bit byte) error
+	ReadByte() (byte, error)
+	WriteByte(value byte) error
+	ReadByteData(cmd byte) (byte, error)
+	WriteByteData(cmd byte, value byte) error
+	ReadWordData(cmd byte) (uint16, error)
+	WriteWordData(cmd byte, value uint16) error
+	ReadBlockData(cmd byte) ([]byte, error)
+	WriteBlockData(cmd byte, data []byte) error
+	ProcessCall(cmd byte, value uint16) (uint16, error)
+}
+
+var _ SMBus = (*I2CDevice)(nil)
+
+// i2cSmbusData mirrors union i2c_smbus_data: block[0] holds the length
+// of a block transfer, and the byte and word members alias its start.
+type i2cSmbusData [I2C_SMBUS_BLOCK_MAX + 2]byte
+
+func (d *i2cSmbusData) word() uint16 {
+	return *(*uint16)(unsafe.Pointer(&d[0]))
+}
+
+func (d *i2cSmbusData) setWord(v uint16) {
+	*(*uint16)(unsafe.Pointer(&d[0])) = v
+}
+
+// i2cSmbusIoctlData mirrors struct i2c_smbus_ioctl_data
+type i2cSmbusIoctlData struct {
+	readWrite uint8
+	command   uint8
+	size      uint32
+	data      *i2cSmbusData
+}
+
+// smbusAccess performs a single SMBus transaction through the I2C_SMBUS ioctl
+func (dev *I2CDevice) smbusAccess(readWrite, command uint8, size uint32, data *i2cSmbusData) error {
+	args := i2cSmbusIoctlData{
+		readWrite: readWrite,
+		command:   command,
+		size:      size,
+		data:      data,
+	}
+	start := time.Now()
+	err := ioctl(dev.File.Fd(), I2C_SMBUS, uintptr(unsafe.Pointer(&args)))
+	out, in := smbusPayload(readWrite, size, data)
+	DefaultMetrics.Observe(dev.busName(), dev.Addr, out, in, time.Since(start), err)
+	if dev.opts.PEC && errors.Is(err, syscall.EBADMSG) {
+		// The kernel checks the PEC byte of the reply and reports a mismatch as EBADMSG
+		return fmt.Errorf("%w: %w", ErrPEC, err)
+	}
+	return err
+}
+
+// smbusPayload returns how many bytes an SMBus transaction wrote and read,
+// addresses excluded
+func smbusPayload(readWrite uint8, size uint32, data *i2cSmbusData) (out, in int) {
+	read := readWrite == I2C_SMBUS_READ
+	switch size {
+	case I2C_SMBUS_QUICK:
+		return 0, 0
+	case I2C_SMBUS_BYTE:
+		if read {
+			return 0, 1
+		}
+		return 1, 0
+	case I2C_SMBUS_BYTE_DATA:
+		if read {
+			return 1, 1
+		}
+		return 2, 0
+	case I2C_SMBUS_WORD_DATA:
+		if read {
+			return 1, 2
+		}
+		return 3, 0
+	case I2C_SMBUS_PROC_CALL:
+		return 3, 2
+	case I2C_SMBUS_BLOCK_DATA:
+		if read {
+			return 1, 1 + int(data[0])
+		}
+		return 2 + int(data[0]), 0
+	}
+	return 1, 0
+}
+
+// WriteQuick sends a quick command, the given bit being used as R/W flag
+func (dev *I2CDevice) WriteQuick(bit byte) error {
+	return dev.smbusAccess(bit, 0, I2C_SMBUS_QUICK, nil)
+}
+
+// ReadByte receives a byte without any command
+func (dev *I2CDevice) ReadByte() (byte, error) {
+	var data i2cSmbusData
+	if err := dev.smbusAccess(I2C_SMBUS_READ, 0, I2C_SMBUS_BYTE, &data); err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+// WriteByte sends a single byte, usually a command
+func (dev *I2CDevice) WriteByte(value byte) error {
+	return dev.smbusAccess(I2C_SMBUS_WRITE, value, I2C_SMBUS_BYTE, nil)
+}
+
+// ReadByteData reads a byte from the given command register
+func (dev *I2CDevice) ReadByteData(cmd byte) (byte, error) {
+	var data i2cSmbusData
+	if err := dev.smbusAccess(I2C_SMBUS_READ, cmd, I2C_SMBUS_BYTE_DATA, &data); err != nil {
+		return 0, err
+	}
+	return data[0], nil
+}
+
+// WriteByteData writes a byte to the given command register
+func (dev *I2CDevice) WriteByteData(cmd byte, value byte) error {
+	var data i2cSmbusData
+	data[0] = value
+	return dev.smbusAccess(I2C_SMBUS_WRITE, cmd, I2C_SMBUS_BYTE_DATA, &data)
+}
+
+// ReadWordData reads a 16-bit little-endian word from the given command register
+func (dev *I2CDevice) ReadWordData(cmd byte) (uint16, error) {
+	var data i2cSmbusData
+	if err := dev.smbusAccess(I2C_SMBUS_READ, cmd, I2C_SMBUS_WORD_DATA, &data); err != nil {
+		return 0, err
+	}
+	return data.word(), nil
+}
+
+// WriteWordData writes a 16-bit little-endian word to the given command register
+func (dev *I2CDevice) WriteWordData(cmd byte, value uint16) error {
+	var data i2cSmbusData
+	data.setWord(value)
+	return dev.smbusAccess(I2C_SMBUS_WRITE, cmd, I2C_SMBUS_WORD_DATA, &data)
+}
+
+// ReadBlockData reads a block of up to 32 bytes, the length being sent by the device
+func (dev *I2CDevice) ReadBlockData(cmd byte) ([]byte, error) {
+	var data i2cSmbusData
+	if err := dev.smbusAccess(I2C_SMBUS_READ, cmd, I2C_SMBUS_BLOCK_DATA, &data); err != nil {
+		return nil, err
+	}
+	n := int(data[0])
+	if n > I2C_SMBUS_BLOCK_MAX {
+		return nil, fmt.Errorf("invalid block length %d", n)
+	}
+	return append([]byte(nil), data[1:1+n]...), nil
+}
+
+// WriteBlockData writes a block of up to 32 bytes, preceded by its length
+func (dev *I2CDevice) WriteBlockData(cmd byte, buf []byte) error {
+	if len(buf) > I2C_SMBUS_BLOCK_MAX {
+		return fmt.Errorf("block too long: %d > %d bytes", len(buf), I2C_SMBUS_BLOCK_MAX)
+	}
+	var data i2cSmbusData
+	data[0] = byte(len(buf))
+	copy(data[1:], buf)
+	return dev.smbusAccess(I2C_SMBUS_WRITE, cmd, I2C_SMBUS_BLOCK_DATA, &data)
+}
+
+// ProcessCall writes a word to the given command register and reads a word back
+func (dev *I2CDevice) ProcessCall(cmd byte, value uint16) (uint16, error) {
+	var data i2cSmbusData
+	data.setWord(value)
+	if err := dev.smbusAccess(I2C_SMBUS_WRITE, cmd, I2C_SMBUS_PROC_CALL, &data); err != nil {
+		return 0, err
+	}
+	return data.word(), nil
+}
@@ -0,0 +1,228 @@
+package i2c
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds of the latency histogram buckets, a
+// last bucket counting the slower transactions
+var LatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+}
+
+// Bucket is a latency histogram bucket, UpTo is "+Inf" for the last one
+type Bucket struct {
+	UpTo  string `json:"up_to"`
+	Count uint64 `json:"count"`
+}
+
+// DeviceStats is a snapshot of the traffic with one device
+type DeviceStats struct {
+	Bus          string            `json:"bus"`
+	Addr         uint16            `json:"addr"`
+	Transactions uint64            `json:"transactions"`
+	BytesOut     uint64            `json:"bytes_out"`
+	BytesIn      uint64            `json:"bytes_in"`
+	Errors       map[string]uint64 `json:"errors,omitempty"` // Count by errno
+	BusyTime     time.Duration     `json:"busy_ns"`          // Total time spent in transactions
+	Latency      []Bucket          `json:"latency"`
+}
+
+// Metrics collects per device bus statistics. A device is an address on a
+// bus, so that devices sharing an address on different adapters or
+// multiplexer channels are counted apart.
+type Metrics struct {
+	mu      sync.Mutex
+	devices map[deviceKey]*deviceStats
+}
+
+type deviceKey struct {
+	bus  string
+	addr uint16
+}
+
+type deviceStats struct {
+	transactions uint64
+	bytesOut     uint64
+	bytesIn      uint64
+	errors       map[string]uint64
+	busy         time.Duration
+	latency      []uint64 // One count per bucket, plus the overflow
+}
+
+// DefaultMetrics collects the statistics of every I2CDevice
+var DefaultMetrics = NewMetrics()
+
+// NewMetrics creates an empty collector
+func NewMetrics() *Metrics {
+	return &Metrics{devices: make(map[deviceKey]*deviceStats)}
+}
+
+// Stats returns a snapshot of the statistics of every I2CDevice
+func Stats() []DeviceStats {
+	return DefaultMetrics.Stats()
+}
+
+// Observe records a transaction with addr on bus, the name of the bus
+// being e.g. "i2c-1"
+func (m *Metrics) Observe(bus string, addr uint16, out, in int, latency time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := deviceKey{bus, addr}
+	dev, ok := m.devices[key]
+	if !ok {
+		dev = &deviceStats{latency: make([]uint64, len(LatencyBuckets)+1)}
+		m.devices[key] = dev
+	}
+
+	dev.transactions++
+	dev.busy += latency
+	bucket := sort.Search(len(LatencyBuckets), func(i int) bool {
+		return latency <= LatencyBuckets[i]
+	})
+	dev.latency[bucket]++
+
+	if err != nil {
+		if dev.errors == nil {
+			dev.errors = make(map[string]uint64)
+		}
+		dev.errors[errnoName(err)]++
+		return
+	}
+	dev.bytesOut += uint64(out)
+	dev.bytesIn += uint64(in)
+}
+
+// ObserveTransfer records a combined transfer on bus, charging each message
+// to its own address. Each address involved counts one transaction with
+// the latency of the whole transfer, the time it actually waited for it, so
+// that the busy times of the addresses add up to more than the bus time.
+func (m *Metrics) ObserveTransfer(bus string, msgs []Msg, latency time.Duration, err error) {
+	type traffic struct {
+		addr    uint16
+		out, in int
+	}
+	var devices []traffic
+	for _, msg := range msgs {
+		i := 0
+		for i < len(devices) && devices[i].addr != msg.Addr {
+			i++
+		}
+		if i == len(devices) {
+			devices = append(devices, traffic{addr: msg.Addr})
+		}
+		if msg.Flags&I2C_M_RD != 0 {
+			devices[i].in += len(msg.Buf)
+		} else {
+			devices[i].out += len(msg.Buf)
+		}
+	}
+	for _, dev := range devices {
+		m.Observe(bus, dev.addr, dev.out, dev.in, latency, err)
+	}
+}
+
+// errnoName gives the key errors are counted under
+func errnoName(err error) string {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno.Error()
+	}
+	return "other"
+}
+
+// Stats returns a snapshot of the statistics, sorted by bus and address
+func (m *Metrics) Stats() []DeviceStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := make([]DeviceStats, 0, len(m.devices))
+	for key, dev := range m.devices {
+		s := DeviceStats{
+			Bus:          key.bus,
+			Addr:         key.addr,
+			Transactions: dev.transactions,
+			BytesOut:     dev.bytesOut,
+			BytesIn:      dev.bytesIn,
+			BusyTime:     dev.busy,
+			Latency:      make([]Bucket, len(dev.latency)),
+		}
+		if len(dev.errors) > 0 {
+			s.Errors = make(map[string]uint64, len(dev.errors))
+			for k, v := range dev.errors {
+				s.Errors[k] = v
+			}
+		}
+		for i, count := range dev.latency {
+			s.Latency[i].Count = count
+			s.Latency[i].UpTo = "+Inf"
+			if i < len(LatencyBuckets) {
+				s.Latency[i].UpTo = LatencyBuckets[i].String()
+			}
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Bus != stats[j].Bus {
+			return stats[i].Bus < stats[j].Bus
+		}
+		return stats[i].Addr < stats[j].Addr
+	})
+	return stats
+}
+
+// Wrap returns a connection recording the transactions of conn under addr
+// on bus, for connections that are not I2CDevices
+func (m *Metrics) Wrap(conn Conn, bus string, addr uint16) Conn {
+	return &statsConn{conn: conn, bus: bus, addr: addr, metrics: m}
+}
+
+type statsConn struct {
+	conn    Conn
+	bus     string
+	addr    uint16
+	metrics *Metrics
+}
+
+func (c *statsConn) Read(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := c.conn.Read(buf)
+	c.metrics.Observe(c.bus, c.addr, 0, n, time.Since(start), err)
+	return n, err
+}
+
+func (c *statsConn) Write(buf []byte) (int, error) {
+	start := time.Now()
+	n, err := c.conn.Write(buf)
+	c.metrics.Observe(c.bus, c.addr, n, 0, time.Since(start), err)
+	return n, err
+}
+
+func (c *statsConn) Tx(w, r []byte) error {
+	start := time.Now()
+	err := c.conn.Tx(w, r)
+	c.metrics.Observe(c.bus, c.addr, len(w), len(r), time.Since(start), err)
+	return err
+}
+
+func (c *statsConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *statsConn) Capabilities() (Capabilities, error) {
+	return CapabilitiesOf(c.conn)
+}
@@ -0,0 +1,61 @@
+package i2c
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	sensor := metrics.Wrap(&fakeConn{present: true}, "i2c-1", 0x44)
+	absent := metrics.Wrap(&fakeConn{}, "i2c-1", 0x45)
+	other := metrics.Wrap(&fakeConn{present: true}, "i2c-1/0x70.5", 0x44)
+
+	sensor.Write([]byte{0x24, 0x00})
+	sensor.Read(make([]byte, 6))
+	sensor.Tx([]byte{0xF3, 0x2D}, make([]byte, 3))
+	absent.Write([]byte{0x24, 0x00})
+	other.Write([]byte{0x24, 0x00})
+
+	stats := metrics.Stats()
+	if len(stats) != 3 {
+		t.Fatalf("got stats for %d devices, want 3", len(stats))
+	}
+	s := stats[0]
+	if s.Bus != "i2c-1" || s.Addr != 0x44 || s.Transactions != 3 || s.BytesOut != 4 || s.BytesIn != 9 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	var count uint64
+	for _, b := range s.Latency {
+		count += b.Count
+	}
+	if count != 3 {
+		t.Errorf("latency histogram counts %d transactions, want 3", count)
+	}
+	if stats[1].Errors["other"] != 1 {
+		t.Errorf("unexpected errors %v", stats[1].Errors)
+	}
+	if s := stats[2]; s.Bus != "i2c-1/0x70.5" || s.Transactions != 1 {
+		t.Errorf("same address on another channel not counted apart: %+v", s)
+	}
+}
+
+func TestObserveTransfer(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.ObserveTransfer("i2c-1", []Msg{
+		{Addr: 0x70, Buf: []byte{0x01}},
+		{Addr: 0x44, Buf: []byte{0x24, 0x00}},
+		{Addr: 0x44, Flags: I2C_M_RD, Buf: make([]byte, 6)},
+	}, 2*time.Millisecond, nil)
+
+	stats := metrics.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("got stats for %d devices, want 2", len(stats))
+	}
+	if s := stats[0]; s.Addr != 0x44 || s.Transactions != 1 || s.BytesOut != 2 || s.BytesIn != 6 || s.BusyTime != 2*time.Millisecond {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s := stats[1]; s.Addr != 0x70 || s.BytesOut != 1 || s.BytesIn != 0 || s.BusyTime != 2*time.Millisecond {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
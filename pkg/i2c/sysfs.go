@@ -0,0 +1,157 @@
+package i2c
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SysfsRoot is where sysfs is mounted. Tests can point it to a fake tree.
+var SysfsRoot = "/sys"
+
+// AdapterInfo describes an I2C adapter found in sysfs
+type AdapterInfo struct {
+	Number  int    // N in /dev/i2c-N
+	Name    string // Adapter name, e.g. "i2c-tiny-usb at bus 001 device 005"
+	Path    string // Resolved sysfs device path
+	USBPath string // USB port path such as "1-1.2", empty for non USB adapters
+}
+
+// usbPortRe matches the sysfs name of a USB port, e.g. "1-1.2"
+var usbPortRe = regexp.MustCompile(`^\d+-\d+(\.\d+)*$`)
+
+// ListAdapters enumerates the I2C adapters registered under the given sysfs
+// root, looking at both class/i2c-adapter and bus/i2c/devices.
+func ListAdapters(root string) ([]AdapterInfo, error) {
+	var links []string
+	for _, dir := range []string{"class/i2c-adapter", "bus/i2c/devices"} {
+		matches, err := filepath.Glob(filepath.Join(root, dir, "i2c-*"))
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, matches...)
+	}
+
+	seen := make(map[int]bool)
+	var adapters []AdapterInfo
+	for _, link := range links {
+		num, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(link), "i2c-"))
+		if err != nil || seen[num] {
+			continue
+		}
+		name, err := os.ReadFile(filepath.Join(link, "name"))
+		if err != nil {
+			continue
+		}
+		path, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			path = link
+		}
+		seen[num] = true
+		adapters = append(adapters, AdapterInfo{
+			Number:  num,
+			Name:    strings.TrimSpace(string(name)),
+			Path:    path,
+			USBPath: usbPath(path),
+		})
+	}
+
+	sort.Slice(adapters, func(i, j int) bool { return adapters[i].Number < adapters[j].Number })
+	return adapters, nil
+}
+
+// usbPath returns the innermost USB port in a sysfs device path
+func usbPath(path string) string {
+	port := ""
+	for _, elem := range strings.Split(filepath.ToSlash(path), "/") {
+		if usbPortRe.MatchString(elem) {
+			port = elem
+		}
+	}
+	return port
+}
+
+// FindAdapter looks up an adapter by name or by USB port path. A name
+// matches when it is a prefix of the adapter name, so "i2c-tiny-usb" finds
+// "i2c-tiny-usb at bus 001 device 005" whatever the USB device number.
+func FindAdapter(root, id string) (AdapterInfo, error) {
+	adapters, err := ListAdapters(root)
+	if err != nil {
+		return AdapterInfo{}, err
+	}
+	for _, a := range adapters {
+		if strings.HasPrefix(a.Name, id) || (a.USBPath != "" && a.USBPath == id) {
+			return a, nil
+		}
+	}
+	return AdapterInfo{}, fmt.Errorf("no i2c adapter matching %q", id)
+}
+
+// OpenByName opens a device on the adapter matching id, as in FindAdapter
+func OpenByName(id string, address uint8) (*I2CDevice, error) {
+	a, err := FindAdapter(SysfsRoot, id)
+	if err != nil {
+		return nil, err
+	}
+	return Init(a.Number, address)
+}
+
+// NamedAdapter is a bus on the adapter matching ID, as in FindAdapter. The
+// adapter is looked up again on each Open, so that a USB adapter plugged
+// back under another number is still found, and another adapter that took
+// its number is not used in its place.
+type NamedAdapter struct {
+	ID      string // Adapter name or USB port path
+	Options Options
+}
+
+var _ ScopedBus = NamedAdapter{}
+
+// Named returns the adapter as a NamedAdapter, identified by its USB port
+// path, or by its name when it is not on USB
+func (a Adapter) Named() (NamedAdapter, error) {
+	adapters, err := ListAdapters(SysfsRoot)
+	if err != nil {
+		return NamedAdapter{}, err
+	}
+	for _, info := range adapters {
+		if info.Number != a.Number {
+			continue
+		}
+		id := info.USBPath
+		if id == "" {
+			id = info.Name
+		}
+		return NamedAdapter{ID: id, Options: a.Options}, nil
+	}
+	return NamedAdapter{}, fmt.Errorf("i2c-%d not found in sysfs", a.Number)
+}
+
+// Find returns the adapter currently matching the ID
+func (a NamedAdapter) Find() (Adapter, error) {
+	info, err := FindAdapter(SysfsRoot, a.ID)
+	if err != nil {
+		return Adapter{}, err
+	}
+	return Adapter{Number: info.Number, Options: a.Options}, nil
+}
+
+// Open opens a connection to the device at addr on the adapter
+func (a NamedAdapter) Open(addr uint16) (Conn, error) {
+	adapter, err := a.Find()
+	if err != nil {
+		return nil, err
+	}
+	return adapter.Open(addr)
+}
+
+// Scope returns the adapter with its devices locked in scope name, as in
+// Adapter.Scope
+func (a NamedAdapter) Scope(name string) Bus {
+	a.Options = a.Options.scoped(name)
+	return a
+}
@@ -0,0 +1,84 @@
+package i2c
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeAdapter adds an adapter to a fake sysfs tree, below the given device path
+func fakeAdapter(t *testing.T, root, devpath string, num int, name string) {
+	t.Helper()
+	adapter := filepath.Join(root, "devices", devpath, "i2c-"+strconv.Itoa(num))
+	if err := os.MkdirAll(adapter, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(adapter, "name"), []byte(name+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	class := filepath.Join(root, "class", "i2c-adapter")
+	if err := os.MkdirAll(class, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(adapter, filepath.Join(class, "i2c-"+strconv.Itoa(num))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindAdapter(t *testing.T) {
+	root := t.TempDir()
+	fakeAdapter(t, root, "pci0000:00/0000:00:02.0", 1, "i915 gmbus dpb")
+	fakeAdapter(t, root, "pci0000:00/0000:00:14.0/usb1/1-1/1-1.2/1-1.2:1.0", 12, "i2c-tiny-usb at bus 001 device 007")
+
+	adapters, err := ListAdapters(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(adapters) != 2 {
+		t.Fatalf("got %d adapters, want 2", len(adapters))
+	}
+	if adapters[1].USBPath != "1-1.2" {
+		t.Errorf("USB path %q, want 1-1.2", adapters[1].USBPath)
+	}
+
+	for _, id := range []string{"i2c-tiny-usb", "1-1.2"} {
+		a, err := FindAdapter(root, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Number != 12 {
+			t.Errorf("FindAdapter(%q) = i2c-%d, want i2c-12", id, a.Number)
+		}
+	}
+
+	if _, err := FindAdapter(root, "ch341"); err == nil {
+		t.Error("expected an error for a missing adapter")
+	}
+}
+
+func TestNamedAdapter(t *testing.T) {
+	SysfsRoot = t.TempDir()
+	defer func() { SysfsRoot = "/sys" }()
+	fakeAdapter(t, SysfsRoot, "pci0000:00/0000:00:14.0/usb1/1-1/1-1.2/1-1.2:1.0", 12, "i2c-tiny-usb at bus 001 device 007")
+
+	named, err := Adapter{Number: 12, Options: Options{NoLock: true}}.Named()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if named.ID != "1-1.2" || !named.Options.NoLock {
+		t.Errorf("got %+v, want the USB path and the options", named)
+	}
+
+	// Plugged back as i2c-13, another adapter took i2c-12
+	SysfsRoot = t.TempDir()
+	fakeAdapter(t, SysfsRoot, "pci0000:00/0000:00:14.0/usb1/1-1/1-1.3/1-1.3:1.0", 12, "i2c-tiny-usb at bus 001 device 008")
+	fakeAdapter(t, SysfsRoot, "pci0000:00/0000:00:14.0/usb1/1-1/1-1.2/1-1.2:1.0", 13, "i2c-tiny-usb at bus 001 device 009")
+	a, err := named.Find()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Number != 13 {
+		t.Errorf("found i2c-%d, want i2c-13", a.Number)
+	}
+}
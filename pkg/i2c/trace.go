@@ -0,0 +1,249 @@
+package i2c
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Transaction kinds of a trace Record
+const (
+	OpRead  = "read"
+	OpWrite = "write"
+	OpTx    = "tx"
+)
+
+// HexBytes is a byte slice written as a hex string in JSON
+type HexBytes []byte
+
+// MarshalText encodes the bytes as hex
+func (b HexBytes) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(b)), nil
+}
+
+// UnmarshalText decodes hex encoded bytes
+func (b *HexBytes) UnmarshalText(text []byte) error {
+	decoded, err := hex.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// Record is a single traced transaction, one line of a JSON Lines trace
+type Record struct {
+	Time  time.Time `json:"time"`
+	Addr  uint16    `json:"addr"`
+	Op    string    `json:"op"`
+	Write HexBytes  `json:"write,omitempty"`
+	Read  HexBytes  `json:"read,omitempty"`
+	Err   string    `json:"err,omitempty"`
+	Errno int       `json:"errno,omitempty"` // Set when Err is a syscall error
+}
+
+// TraceLog writes the transactions of the connections it wraps as JSON Lines
+type TraceLog struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	now func() time.Time
+}
+
+// NewTraceLog creates a trace log writing to w
+func NewTraceLog(w io.Writer) *TraceLog {
+	return &TraceLog{enc: json.NewEncoder(w), now: time.Now}
+}
+
+// Wrap returns a connection tracing every transaction made through conn
+func (l *TraceLog) Wrap(conn Conn, addr uint16) Conn {
+	return &traceConn{conn: conn, addr: addr, log: l}
+}
+
+// WrapBus returns a bus tracing every connection opened on it
+func (l *TraceLog) WrapBus(bus Bus) Bus {
+	return &traceBus{bus: bus, log: l}
+}
+
+// write appends a record to the log
+func (l *TraceLog) write(rec Record, err error) {
+	if err != nil {
+		rec.Err = err.Error()
+		var errno syscall.Errno
+		if errors.As(err, &errno) {
+			rec.Errno = int(errno)
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Time = l.now()
+	l.enc.Encode(rec)
+}
+
+type traceBus struct {
+	bus Bus
+	log *TraceLog
+}
+
+func (b *traceBus) Open(addr uint16) (Conn, error) {
+	conn, err := b.bus.Open(addr)
+	if err != nil {
+		return nil, err
+	}
+	return b.log.Wrap(conn, addr), nil
+}
+
+func (b *traceBus) Scope(name string) Bus {
+	return &traceBus{bus: Scope(b.bus, name), log: b.log}
+}
+
+type traceConn struct {
+	conn Conn
+	addr uint16
+	log  *TraceLog
+}
+
+func (c *traceConn) Read(buf []byte) (int, error) {
+	n, err := c.conn.Read(buf)
+	c.log.write(Record{Addr: c.addr, Op: OpRead, Read: buf[:n]}, err)
+	return n, err
+}
+
+func (c *traceConn) Write(buf []byte) (int, error) {
+	n, err := c.conn.Write(buf)
+	c.log.write(Record{Addr: c.addr, Op: OpWrite, Write: buf}, err)
+	return n, err
+}
+
+func (c *traceConn) Tx(w, r []byte) error {
+	err := c.conn.Tx(w, r)
+	c.log.write(Record{Addr: c.addr, Op: OpTx, Write: w, Read: r}, err)
+	return err
+}
+
+func (c *traceConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *traceConn) Capabilities() (Capabilities, error) {
+	return CapabilitiesOf(c.conn)
+}
+
+// ErrReplayMismatch is returned when a replayed driver does not issue the
+// transactions that were recorded
+var ErrReplayMismatch = errors.New("i2c replay mismatch")
+
+// Replay is a bus serving the reads of a recorded trace back. Each address
+// replays its own records in order, and every transaction must match the
+// recorded one, so that a field capture becomes a deterministic test.
+type Replay struct {
+	mu      sync.Mutex
+	records map[uint16][]Record
+}
+
+var _ Bus = (*Replay)(nil)
+
+// NewReplay loads a JSON Lines trace
+func NewReplay(r io.Reader) (*Replay, error) {
+	p := &Replay{records: make(map[uint16][]Record)}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("trace line %d: %w", line, err)
+		}
+		p.records[rec.Addr] = append(p.records[rec.Addr], rec)
+	}
+	return p, scanner.Err()
+}
+
+// Open returns a connection replaying the records of addr
+func (p *Replay) Open(addr uint16) (Conn, error) {
+	return &replayConn{replay: p, addr: addr}, nil
+}
+
+// Remaining returns the number of records that were not replayed yet
+func (p *Replay) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, recs := range p.records {
+		n += len(recs)
+	}
+	return n
+}
+
+// next pops the next record of addr, checking it matches the transaction
+func (p *Replay) next(addr uint16, op string, w []byte, rlen int) (Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	recs := p.records[addr]
+	if len(recs) == 0 {
+		return Record{}, fmt.Errorf("%w: unexpected %s at %#02x, trace exhausted", ErrReplayMismatch, op, addr)
+	}
+	rec := recs[0]
+	if rec.Op != op || !bytes.Equal(rec.Write, w) || (op != OpWrite && rec.Err == "" && len(rec.Read) != rlen) {
+		return Record{}, fmt.Errorf("%w: got %s %x (read %d) at %#02x, recorded %s %x (read %d)",
+			ErrReplayMismatch, op, w, rlen, addr, rec.Op, []byte(rec.Write), len(rec.Read))
+	}
+	p.records[addr] = recs[1:]
+	return rec, nil
+}
+
+// recordedErr rebuilds the error of a record
+func recordedErr(rec Record) error {
+	switch {
+	case rec.Errno != 0:
+		return syscall.Errno(rec.Errno)
+	case rec.Err != "":
+		return errors.New(rec.Err)
+	}
+	return nil
+}
+
+type replayConn struct {
+	replay *Replay
+	addr   uint16
+}
+
+func (c *replayConn) Read(buf []byte) (int, error) {
+	rec, err := c.replay.next(c.addr, OpRead, nil, len(buf))
+	if err != nil {
+		return 0, err
+	}
+	return copy(buf, rec.Read), recordedErr(rec)
+}
+
+func (c *replayConn) Write(buf []byte) (int, error) {
+	rec, err := c.replay.next(c.addr, OpWrite, buf, 0)
+	if err != nil {
+		return 0, err
+	}
+	if err := recordedErr(rec); err != nil {
+		return 0, err
+	}
+	return len(buf), nil
+}
+
+func (c *replayConn) Tx(w, r []byte) error {
+	rec, err := c.replay.next(c.addr, OpTx, w, len(r))
+	if err != nil {
+		return err
+	}
+	copy(r, rec.Read)
+	return recordedErr(rec)
+}
+
+func (c *replayConn) Close() error {
+	return nil
+}
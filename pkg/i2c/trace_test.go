@@ -0,0 +1,40 @@
+package i2c
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTraceReplay(t *testing.T) {
+	var trace bytes.Buffer
+	bus := NewTraceLog(&trace).WrapBus(fakeBus{0x44: true})
+
+	conn, err := bus.Open(0x44)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte{0x24, 0x00})
+	conn.Tx([]byte{0xF3, 0x2D}, make([]byte, 3))
+	absent, _ := bus.Open(0x45)
+	absent.Write([]byte{0x24, 0x00})
+
+	replay, err := NewReplay(&trace)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, _ = replay.Open(0x44)
+	if _, err := conn.Write([]byte{0x24, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.Tx([]byte{0xF3, 0x2D}, make([]byte, 3)); err != nil {
+		t.Fatal(err)
+	}
+	absent, _ = replay.Open(0x45)
+	if _, err := absent.Write([]byte{0x24, 0x00}); err == nil || err.Error() != "nack" {
+		t.Errorf("got %v, want the recorded error", err)
+	}
+	if _, err := conn.Write([]byte{0x30, 0xA2}); !errors.Is(err, ErrReplayMismatch) {
+		t.Errorf("got %v, want ErrReplayMismatch", err)
+	}
+}
@@ -0,0 +1,260 @@
+// Package probe tells which chips answer on a bus. Each address known to be
+// used by a supported chip has a list of candidates, checked in turn with a
+// routine that only reads from the chip, so that probing never changes its
+// state.
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+
+	"dev/pkg/i2c"
+	"dev/pkg/sht31"
+	"dev/pkg/ssd1306"
+	"dev/pkg/ssh1107"
+)
+
+// Chips known to the probe database
+const (
+	ChipSHT31   = "sht31"
+	ChipSH1107  = "sh1107"
+	ChipSSD1306 = "ssd1306"
+	ChipBME280  = "bme280"
+	ChipBMP280  = "bmp280"
+	ChipMPU6050 = "mpu6050"
+)
+
+var (
+	// ErrNoDriver is returned when creating the driver of a chip there is
+	// no driver for yet
+	ErrNoDriver = errors.New("no driver for this chip")
+	// ErrAmbiguous is returned when creating the driver of a chip the probe
+	// could not tell apart from other candidates
+	ErrAmbiguous = errors.New("chip not told apart from other candidates")
+)
+
+// Candidate is a chip that may answer at an address
+type Candidate struct {
+	Chip string
+	// Identify reports whether the chip answering on conn is this one,
+	// with details such as its serial number
+	Identify func(conn i2c.Conn) (detail string, ok bool)
+	// New creates the driver of the chip, nil when there is none
+	New func(conn i2c.Conn) (any, error)
+}
+
+var (
+	sht31Candidate = Candidate{
+		Chip:     ChipSHT31,
+		Identify: identifySHT31,
+		New:      func(conn i2c.Conn) (any, error) { return sht31.NewSHT31(conn) },
+	}
+	sh1107Candidate = Candidate{
+		Chip:     ChipSH1107,
+		Identify: identifyOLED,
+		New: func(conn i2c.Conn) (any, error) {
+			return ssh1107.NewDisplay(conn, ssh1107.NewScreen(128, 128))
+		},
+	}
+	ssd1306Candidate = Candidate{
+		Chip:     ChipSSD1306,
+		Identify: identifyOLED,
+		New: func(conn i2c.Conn) (any, error) {
+			return ssd1306.NewDisplay(conn, ssd1306.NewScreen(64, 128, false))
+		},
+	}
+	bme280Candidate  = Candidate{Chip: ChipBME280, Identify: ChipID(0xD0, 0x60)}
+	bmp280Candidate  = Candidate{Chip: ChipBMP280, Identify: ChipID(0xD0, 0x56, 0x57, 0x58)}
+	mpu6050Candidate = Candidate{Chip: ChipMPU6050, Identify: ChipID(0x75, 0x68)}
+)
+
+// DB maps addresses to the chips that may answer there, most likely first
+var DB = map[uint16][]Candidate{
+	0x3C: {sh1107Candidate, ssd1306Candidate},
+	0x3D: {sh1107Candidate, ssd1306Candidate},
+	0x44: {sht31Candidate},
+	0x45: {sht31Candidate},
+	0x68: {mpu6050Candidate},
+	0x69: {mpu6050Candidate},
+	0x76: {bme280Candidate, bmp280Candidate},
+	0x77: {bme280Candidate, bmp280Candidate},
+}
+
+// Identity is a chip found on the bus
+type Identity struct {
+	Addr   uint16
+	Chip   string // Empty when no candidate recognized the chip
+	Detail string
+	Others []string // Other candidates recognizing the chip as well
+	Err    error    // Why the address could not be probed, such as a lock held by another process
+
+	candidate *Candidate
+}
+
+// Ambiguous reports whether several candidates recognized the chip, the
+// probe then only knows it is one of them
+func (id Identity) Ambiguous() bool {
+	return len(id.Others) > 0
+}
+
+func (id Identity) String() string {
+	chip := strings.Join(append([]string{id.Chip}, id.Others...), " or ")
+	switch {
+	case errors.Is(id.Err, syscall.EBUSY):
+		return fmt.Sprintf("%#02x busy (%v)", id.Addr, id.Err)
+	case id.Err != nil:
+		return fmt.Sprintf("%#02x unknown (%v)", id.Addr, id.Err)
+	case id.Chip == "":
+		return fmt.Sprintf("%#02x unknown", id.Addr)
+	case id.Detail == "":
+		return fmt.Sprintf("%#02x %s", id.Addr, chip)
+	}
+	return fmt.Sprintf("%#02x %s (%s)", id.Addr, chip, id.Detail)
+}
+
+// Driver is a driver created for an identified chip
+type Driver struct {
+	Identity
+	Conn   i2c.Conn // Connection the driver runs on, to close when done
+	Device any      // *sht31.SHT31, ssh1107.Display or ssd1306.Display
+}
+
+/////////////////////////////////////////////////////////
+//
+// # Interface Functions
+//
+////////////////////////////////////////////////////////
+
+// Identify checks the candidates of each address found by i2c.Scan. An
+// address that cannot be opened, such as one in use by another process, is
+// reported with the error in its Identity.
+func Identify(bus i2c.Bus, found []uint16) []Identity {
+	var ids []Identity
+	for _, addr := range found {
+		ids = append(ids, identify(bus, addr))
+	}
+	return ids
+}
+
+// New creates the drivers of the identified chips that have one. Chips not
+// told apart from other candidates are left out, see Identity.Ambiguous.
+func New(bus i2c.Bus, ids []Identity) ([]Driver, error) {
+	var drivers []Driver
+	for _, id := range ids {
+		if id.candidate == nil || id.candidate.New == nil || id.Ambiguous() {
+			continue
+		}
+		drv, err := Open(bus, id)
+		if err != nil {
+			for _, d := range drivers {
+				d.Conn.Close()
+			}
+			return nil, err
+		}
+		drivers = append(drivers, drv)
+	}
+	return drivers, nil
+}
+
+// Open creates the driver of an identified chip
+func Open(bus i2c.Bus, id Identity) (Driver, error) {
+	if id.candidate == nil || id.candidate.New == nil {
+		return Driver{}, fmt.Errorf("%v: %w", id, ErrNoDriver)
+	}
+	if id.Ambiguous() {
+		return Driver{}, fmt.Errorf("%v: %w", id, ErrAmbiguous)
+	}
+	conn, err := bus.Open(id.Addr)
+	if err != nil {
+		return Driver{}, err
+	}
+	dev, err := id.candidate.New(conn)
+	if err != nil {
+		conn.Close()
+		return Driver{}, fmt.Errorf("%v: %w", id, err)
+	}
+	return Driver{Identity: id, Conn: conn, Device: dev}, nil
+}
+
+// ChipID returns an identify routine reading the ID register reg, for
+// chips having one, and matching it against ids
+func ChipID(reg byte, ids ...byte) func(i2c.Conn) (string, bool) {
+	return func(conn i2c.Conn) (string, bool) {
+		buf := make([]byte, 1)
+		if err := conn.Tx([]byte{reg}, buf); err != nil {
+			return "", false
+		}
+		for _, id := range ids {
+			if buf[0] == id {
+				return fmt.Sprintf("chip id %#02x", id), true
+			}
+		}
+		return "", false
+	}
+}
+
+////////////////////////////////////////////////////////
+//
+// # Private Functions
+//
+////////////////////////////////////////////////////////
+
+// identify returns the first candidate of addr recognizing the chip, along
+// with the others recognizing it as well
+func identify(bus i2c.Bus, addr uint16) Identity {
+	id := Identity{Addr: addr}
+	candidates := DB[addr]
+	if len(candidates) == 0 {
+		return id
+	}
+
+	conn, err := bus.Open(addr)
+	if err != nil {
+		id.Err = err
+		return id
+	}
+	defer conn.Close()
+
+	for i := range candidates {
+		detail, ok := candidates[i].Identify(conn)
+		switch {
+		case !ok:
+		case id.candidate == nil:
+			id.Chip, id.Detail, id.candidate = candidates[i].Chip, detail, &candidates[i]
+		default:
+			id.Others = append(id.Others, candidates[i].Chip)
+		}
+	}
+	return id
+}
+
+// identifySHT31 reads the serial number, which only a sensor computing the
+// Sensirion CRC returns right
+func identifySHT31(conn i2c.Conn) (string, bool) {
+	sensor, err := sht31.NewSHT31(conn)
+	if err != nil {
+		return "", false
+	}
+	serial, err := sensor.ReadSerial()
+	if err != nil {
+		return "", false
+	}
+	return fmt.Sprintf("serial %08x", serial), true
+}
+
+// identifyOLED reads the status byte of an OLED controller, read without a
+// control byte, which reports the display being off in bit 6. The datasheets
+// do not document the other bits well enough to tell the SSD1306 and SH1107
+// apart by them, so both candidates recognize either controller.
+func identifyOLED(conn i2c.Conn) (string, bool) {
+	buf := make([]byte, 1)
+	if _, err := conn.Read(buf); err != nil {
+		return "", false
+	}
+	if buf[0]&0x40 != 0 {
+		return "display off", true
+	}
+	return "display on", true
+}
@@ -0,0 +1,129 @@
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"testing"
+
+	"dev/pkg/i2c"
+	"dev/pkg/i2c/sim"
+	"dev/pkg/sht31"
+)
+
+// idChip is a chip answering its ID register, and 0xFF for the others
+type idChip struct {
+	reg, id byte
+	ptr     byte
+}
+
+func (c *idChip) Write(data []byte) error {
+	if len(data) > 0 {
+		c.ptr = data[0]
+	}
+	return nil
+}
+
+func (c *idChip) Read(buf []byte) error {
+	for i := range buf {
+		buf[i] = 0xFF
+	}
+	if c.ptr == c.reg {
+		buf[0] = c.id
+	}
+	return nil
+}
+
+// busyBus is a bus whose addresses in busy are locked by another process
+type busyBus struct {
+	*sim.Bus
+	busy map[uint16]bool
+}
+
+func (b *busyBus) Open(addr uint16) (i2c.Conn, error) {
+	if b.busy[addr] {
+		return nil, &i2c.LockError{Path: fmt.Sprintf("i2c-1-%#02x.lock", addr), PID: 42, Command: "main"}
+	}
+	return b.Bus.Open(addr)
+}
+
+func TestIdentify(t *testing.T) {
+	bus := sim.NewBus()
+	bus.Attach(0x3C, sim.NewDisplay(sim.SH1107))
+	bus.Attach(0x3D, sim.NewDisplay(sim.SSD1306))
+	bus.Attach(0x44, sim.NewSHT31(21.5, 48.25))
+	bus.Attach(0x76, &idChip{reg: 0xD0, id: 0x58})
+	bus.Attach(0x77, &idChip{reg: 0xD0, id: 0x42})
+	bus.Attach(0x50, &idChip{})
+
+	found, err := i2c.Scan(bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := Identify(bus, found)
+	want := []string{
+		"0x3c sh1107 or ssd1306 (display off)",
+		"0x3d sh1107 or ssd1306 (display off)",
+		"0x44 sht31 (serial 0c5a1f37)",
+		"0x50 unknown",
+		"0x76 bmp280 (chip id 0x58)",
+		"0x77 unknown",
+	}
+	if len(ids) != len(want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if got := ids[i].String(); got != want[i] {
+			t.Errorf("got %q, want %q", got, want[i])
+		}
+	}
+
+	drivers, err := New(bus, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(drivers) != 1 {
+		t.Fatalf("got %d drivers, want 1", len(drivers))
+	}
+	if _, ok := drivers[0].Device.(*sht31.SHT31); !ok {
+		t.Errorf("got %T for the SHT31", drivers[0].Device)
+	}
+	if _, err := Open(bus, ids[0]); !errors.Is(err, ErrAmbiguous) {
+		t.Errorf("got %v for the OLED controller, want ErrAmbiguous", err)
+	}
+	if _, err := Open(bus, ids[4]); !errors.Is(err, ErrNoDriver) {
+		t.Errorf("got %v for the BMP280, want ErrNoDriver", err)
+	}
+}
+
+func TestIdentifyBusy(t *testing.T) {
+	bus := &busyBus{Bus: sim.NewBus(), busy: map[uint16]bool{0x3C: true}}
+	bus.Attach(0x3C, sim.NewDisplay(sim.SH1107))
+	bus.Attach(0x44, sim.NewSHT31(21.5, 48.25))
+
+	found, err := i2c.Scan(bus)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := Identify(bus, found)
+	want := []string{
+		"0x3c busy (i2c-1-0x3c.lock is locked by pid 42 (main))",
+		"0x44 sht31 (serial 0c5a1f37)",
+	}
+	if len(ids) != len(want) {
+		t.Fatalf("got %v, want %v", ids, want)
+	}
+	for i := range want {
+		if got := ids[i].String(); got != want[i] {
+			t.Errorf("got %q, want %q", got, want[i])
+		}
+	}
+	if !errors.Is(ids[0].Err, syscall.EBUSY) {
+		t.Errorf("got %v, want EBUSY", ids[0].Err)
+	}
+
+	drivers, err := New(bus, ids)
+	if err != nil || len(drivers) != 1 {
+		t.Errorf("got %d drivers, %v, want the SHT31 only", len(drivers), err)
+	}
+}
@@ -0,0 +1,128 @@
+// Package psychrometrics derives the usual moist air values from a
+// temperature in °C and a relative humidity in %, as measured by the SHT31.
+//
+// Vapor pressures use the Magnus formula with the coefficients recommended
+// by Sensirion, valid from -45 °C to 60 °C over water.
+package psychrometrics
+
+import "math"
+
+// Magnus coefficients, over water and over ice
+const (
+	magnusA    = 17.62
+	magnusB    = 243.12 // °C
+	magnusAIce = 22.46
+	magnusBIce = 272.62 // °C
+	magnusE0   = 6.112  // hPa, saturation vapor pressure at 0 °C
+)
+
+// minHumidity is the resolution of the SHT31, in %RH. The dew and frost
+// points go to minus infinity with the humidity, so lower readings are
+// taken as this one.
+const minHumidity = 0.01
+
+// StandardPressure is the sea level atmospheric pressure, in hPa
+const StandardPressure = 1013.25
+
+// Values are the values derived from a measurement
+type Values struct {
+	Temperature      float64 `json:"temperature"`       // °C
+	Humidity         float64 `json:"humidity"`          // %RH
+	DewPoint         float64 `json:"dew_point"`         // °C
+	FrostPoint       float64 `json:"frost_point"`       // °C
+	AbsoluteHumidity float64 `json:"absolute_humidity"` // g/m³
+	MixingRatio      float64 `json:"mixing_ratio"`      // g/kg, at StandardPressure
+	VPD              float64 `json:"vpd"`               // kPa
+	Humidex          float64 `json:"humidex"`
+	HeatIndex        float64 `json:"heat_index"` // °C
+}
+
+// Compute derives all the values from a measurement
+func Compute(t, rh float64) Values {
+	return Values{
+		Temperature:      t,
+		Humidity:         rh,
+		DewPoint:         DewPoint(t, rh),
+		FrostPoint:       FrostPoint(t, rh),
+		AbsoluteHumidity: AbsoluteHumidity(t, rh),
+		MixingRatio:      MixingRatio(t, rh, StandardPressure),
+		VPD:              VPD(t, rh),
+		Humidex:          Humidex(t, rh),
+		HeatIndex:        HeatIndex(t, rh),
+	}
+}
+
+// SaturationVaporPressure returns the vapor pressure of saturated air over
+// water at temperature t, in hPa
+func SaturationVaporPressure(t float64) float64 {
+	return magnusE0 * math.Exp(magnusA*t/(magnusB+t))
+}
+
+// VaporPressure returns the partial pressure of water vapor, in hPa
+func VaporPressure(t, rh float64) float64 {
+	return rh / 100 * SaturationVaporPressure(t)
+}
+
+// DewPoint returns the temperature at which the air gets saturated when
+// cooled, in °C
+func DewPoint(t, rh float64) float64 {
+	g := math.Log(math.Max(rh, minHumidity)/100) + magnusA*t/(magnusB+t)
+	return magnusB * g / (magnusA - g)
+}
+
+// FrostPoint returns the temperature at which frost forms when the air is
+// cooled, in °C. It is only meaningful below 0 °C, where it is above the
+// dew point.
+func FrostPoint(t, rh float64) float64 {
+	g := math.Log(VaporPressure(t, math.Max(rh, minHumidity)) / magnusE0)
+	return magnusBIce * g / (magnusAIce - g)
+}
+
+// AbsoluteHumidity returns the mass of water vapor per volume of air, in g/m³
+func AbsoluteHumidity(t, rh float64) float64 {
+	// 216.7 is 100 (hPa to Pa) * 1000 (kg to g) / 461.5 J/(kg·K), the
+	// specific gas constant of water vapor
+	return 216.7 * VaporPressure(t, rh) / (273.15 + t)
+}
+
+// MixingRatio returns the mass of water vapor per mass of dry air, in g/kg,
+// at the given atmospheric pressure in hPa
+func MixingRatio(t, rh, pressure float64) float64 {
+	e := VaporPressure(t, rh)
+	return 622 * e / (pressure - e)
+}
+
+// VPD returns the vapor pressure deficit, how much more water vapor the air
+// could hold, in kPa
+func VPD(t, rh float64) float64 {
+	return SaturationVaporPressure(t) * (1 - rh/100) / 10
+}
+
+// Humidex returns the Canadian humidex, a felt temperature without unit
+func Humidex(t, rh float64) float64 {
+	td := DewPoint(t, rh) + 273.15
+	e := 6.11 * math.Exp(5417.7530*(1/273.16-1/td))
+	return t + 0.5555*(e-10)
+}
+
+// HeatIndex returns the felt temperature of the US National Weather
+// Service, in °C. Below about 27 °C it is close to the air temperature.
+func HeatIndex(t, rh float64) float64 {
+	f := t*9/5 + 32
+
+	// Steadman's simple formula, used when its result is below 80 °F
+	hi := 0.5 * (f + 61 + (f-68)*1.2 + rh*0.094)
+	if (hi+f)/2 >= 80 {
+		// Rothfusz regression, with the NWS adjustments
+		hi = -42.379 + 2.04901523*f + 10.14333127*rh -
+			0.22475541*f*rh - 0.00683783*f*f - 0.05481717*rh*rh +
+			0.00122874*f*f*rh + 0.00085282*f*rh*rh - 0.00000199*f*f*rh*rh
+		switch {
+		case rh < 13 && f >= 80 && f <= 112:
+			hi -= (13 - rh) / 4 * math.Sqrt((17-math.Abs(f-95))/17)
+		case rh > 85 && f >= 80 && f <= 87:
+			hi += (rh - 85) / 10 * (87 - f) / 5
+		}
+	}
+	return (hi - 32) * 5 / 9
+}
@@ -0,0 +1,77 @@
+package psychrometrics
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// fahrenheit converts a temperature of the NWS heat index table to °C
+func fahrenheit(f float64) float64 {
+	return (f - 32) * 5 / 9
+}
+
+func TestDerived(t *testing.T) {
+	tests := []struct {
+		name  string
+		fn    func(t, rh float64) float64
+		t, rh float64
+		want  float64
+		tol   float64
+	}{
+		{"dew point", DewPoint, 20, 50, 9.3, 0.1},
+		{"dew point", DewPoint, 25, 50, 13.9, 0.1},
+		{"dew point", DewPoint, 30, 80, 26.2, 0.1},
+		{"dew point", DewPoint, 0, 90, -1.4, 0.1},
+		{"dew point", DewPoint, 20, 100, 20, 0.01},
+		{"dew point", DewPoint, 20, 0, -75.1, 0.1}, // Taken at 0.01 %RH
+		{"frost point", FrostPoint, -10, 80, -11.4, 0.2},
+		{"frost point", FrostPoint, -10, 100, -8.9, 0.2},
+		{"frost point", FrostPoint, -10, 0, -83.8, 0.2},
+		{"absolute humidity", AbsoluteHumidity, 20, 50, 8.6, 0.1},
+		{"absolute humidity", AbsoluteHumidity, 30, 80, 24.3, 0.2},
+		{"vpd", VPD, 25, 50, 1.58, 0.01},
+		{"vpd", VPD, 20, 50, 1.17, 0.01},
+		{"humidex", Humidex, 30, 70, 41, 0.5},
+		{"humidex", Humidex, 30, 50, 36, 0.5},
+		{"humidex", Humidex, 35, 60, 48, 1},
+		{"humidex", Humidex, 30, 100, 48.6, 0.5},
+		{"humidex", Humidex, 30, 0, 24.4, 0.5},
+		{"heat index", HeatIndex, fahrenheit(80), 40, fahrenheit(80), 0.6},
+		{"heat index", HeatIndex, fahrenheit(90), 70, fahrenheit(106), 0.6},
+		{"heat index", HeatIndex, fahrenheit(100), 50, fahrenheit(118), 0.6},
+	}
+	for _, tt := range tests {
+		if got := tt.fn(tt.t, tt.rh); math.Abs(got-tt.want) > tt.tol {
+			t.Errorf("%s(%g °C, %g %%): got %.2f, want %g ± %g", tt.name, tt.t, tt.rh, got, tt.want, tt.tol)
+		}
+	}
+}
+
+func TestMixingRatio(t *testing.T) {
+	tests := []struct {
+		t, rh, pressure float64
+		want            float64
+	}{
+		{25, 50, StandardPressure, 9.9},
+		{20, 50, StandardPressure, 7.3},
+		{20, 50, 850, 8.7}, // About 1500 m above sea level
+	}
+	for _, tt := range tests {
+		if got := MixingRatio(tt.t, tt.rh, tt.pressure); math.Abs(got-tt.want) > 0.1 {
+			t.Errorf("MixingRatio(%g °C, %g %%, %g hPa): got %.2f g/kg, want %g", tt.t, tt.rh, tt.pressure, got, tt.want)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	v := Compute(25, 50)
+	if v.DewPoint != DewPoint(25, 50) || v.HeatIndex != HeatIndex(25, 50) || v.Humidity != 50 {
+		t.Errorf("got %+v", v)
+	}
+
+	// JSON has no NaN nor infinity, a dry reading must still encode
+	if _, err := json.Marshal(Compute(20, 0)); err != nil {
+		t.Error(err)
+	}
+}
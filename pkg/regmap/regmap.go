@@ -0,0 +1,352 @@
+// Package regmap describes the registers of an I2C chip declaratively, and
+// gives typed access to them and to their bitfields.
+//
+// Chips driven by a command stream, such as the SSD1306 and SH1107 OLED
+// controllers, are left out: they have no register to read back, most
+// commands carry their value in the command byte itself (0xAE/0xAF for
+// display off/on, 0xB0|page), and the frame data is streamed rather than
+// stored at an address.
+package regmap
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"dev/pkg/i2c"
+)
+
+var (
+	// ErrNotCached is returned when reading a write-only register never written
+	ErrNotCached = errors.New("regmap: write-only register not written yet")
+	// ErrCRC is returned when the CRC of a register word is wrong
+	ErrCRC = errors.New("regmap: CRC mismatch")
+)
+
+// Field is a bitfield of a register
+type Field struct {
+	Name  string
+	Shift uint // Position of the least significant bit
+	Width uint // Number of bits
+}
+
+// Register describes a register. Registers are addressed by writing their
+// address, then read back or written in the same transfer.
+type Register struct {
+	Name         string
+	Addr         uint16
+	WriteAddr    uint16 // Address written to, when it differs from Addr
+	AddrWidth    int    // Bytes of address on the wire, 1 when zero
+	Width        int    // Bytes of value, 1 when zero, up to 8
+	LittleEndian bool   // Byte order of the value, big-endian by default
+	ReadOnly     bool
+	WriteOnly    bool // Reads are served from the last written value
+
+	// CRC, when set, computes the checksum following each 16-bit word of
+	// the value on the wire, as Sensirion sensors do
+	CRC func(data []byte) uint8
+
+	Fields []Field
+}
+
+// Map gives access to the registers of a device
+type Map struct {
+	conn i2c.Conn
+
+	mu    sync.Mutex
+	regs  map[string]*Register
+	cache map[string]uint64
+}
+
+// New checks the register declarations and returns a map accessing them through conn
+func New(conn i2c.Conn, regs ...Register) (*Map, error) {
+	m := &Map{
+		conn:  conn,
+		regs:  make(map[string]*Register, len(regs)),
+		cache: make(map[string]uint64),
+	}
+	for i := range regs {
+		reg := regs[i]
+		if reg.AddrWidth == 0 {
+			reg.AddrWidth = 1
+		}
+		if reg.Width == 0 {
+			reg.Width = 1
+		}
+		if err := reg.check(); err != nil {
+			return nil, err
+		}
+		if _, ok := m.regs[reg.Name]; ok {
+			return nil, fmt.Errorf("regmap: duplicate register %q", reg.Name)
+		}
+		m.regs[reg.Name] = &reg
+	}
+	return m, nil
+}
+
+// check validates a register declaration
+func (r *Register) check() error {
+	switch {
+	case r.AddrWidth != 1 && r.AddrWidth != 2:
+		return fmt.Errorf("regmap: register %q: invalid address width %d", r.Name, r.AddrWidth)
+	case r.Width < 1 || r.Width > 8:
+		return fmt.Errorf("regmap: register %q: invalid width %d", r.Name, r.Width)
+	case r.CRC != nil && r.Width%2 != 0:
+		return fmt.Errorf("regmap: register %q: CRC words need an even width", r.Name)
+	case r.ReadOnly && r.WriteOnly:
+		return fmt.Errorf("regmap: register %q is both read-only and write-only", r.Name)
+	}
+
+	var used uint64
+	for _, f := range r.Fields {
+		if f.Width == 0 || f.Shift+f.Width > uint(8*r.Width) {
+			return fmt.Errorf("regmap: field %s.%s does not fit in the register", r.Name, f.Name)
+		}
+		if used&f.mask() != 0 {
+			return fmt.Errorf("regmap: field %s.%s overlaps another field", r.Name, f.Name)
+		}
+		used |= f.mask()
+	}
+	return nil
+}
+
+// mask returns the bits of the field in the register
+func (f Field) mask() uint64 {
+	return (1<<f.Width - 1) << f.Shift
+}
+
+// Get extracts the value of the field from the value of its register
+func (f Field) Get(value uint64) uint64 {
+	return (value & f.mask()) >> f.Shift
+}
+
+// Field returns a field of the register by name
+func (r *Register) Field(name string) (Field, bool) {
+	for _, f := range r.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// register returns a register declaration by name
+func (m *Map) register(name string) (*Register, error) {
+	reg, ok := m.regs[name]
+	if !ok {
+		return nil, fmt.Errorf("regmap: unknown register %q", name)
+	}
+	return reg, nil
+}
+
+// field returns a register and one of its fields by name
+func (m *Map) field(regName, fieldName string) (*Register, Field, error) {
+	reg, err := m.register(regName)
+	if err != nil {
+		return nil, Field{}, err
+	}
+	if f, ok := reg.Field(fieldName); ok {
+		return reg, f, nil
+	}
+	return nil, Field{}, fmt.Errorf("regmap: unknown field %s.%s", regName, fieldName)
+}
+
+// Read returns the value of a register
+func (m *Map) Read(name string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reg, err := m.register(name)
+	if err != nil {
+		return 0, err
+	}
+	return m.read(reg)
+}
+
+// Write sets the value of a register
+func (m *Map) Write(name string, value uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reg, err := m.register(name)
+	if err != nil {
+		return err
+	}
+	return m.write(reg, value)
+}
+
+// Update changes the bits of mask in a register to those of value
+func (m *Map) Update(name string, mask, value uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reg, err := m.register(name)
+	if err != nil {
+		return err
+	}
+	return m.update(reg, mask, value)
+}
+
+// Get returns the value of a bitfield
+func (m *Map) Get(regName, fieldName string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reg, f, err := m.field(regName, fieldName)
+	if err != nil {
+		return 0, err
+	}
+	value, err := m.read(reg)
+	if err != nil {
+		return 0, err
+	}
+	return f.Get(value), nil
+}
+
+// Set changes the value of a bitfield, leaving the rest of the register untouched
+func (m *Map) Set(regName, fieldName string, value uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	reg, f, err := m.field(regName, fieldName)
+	if err != nil {
+		return err
+	}
+	if value > f.mask()>>f.Shift {
+		return fmt.Errorf("regmap: value %#x does not fit in %s.%s", value, regName, fieldName)
+	}
+	return m.update(reg, f.mask(), value<<f.Shift)
+}
+
+// GetBool returns the value of a one bit field
+func (m *Map) GetBool(regName, fieldName string) (bool, error) {
+	value, err := m.Get(regName, fieldName)
+	return value != 0, err
+}
+
+// SetBool changes the value of a one bit field
+func (m *Map) SetBool(regName, fieldName string, value bool) error {
+	var v uint64
+	if value {
+		v = 1
+	}
+	return m.Set(regName, fieldName, v)
+}
+
+// update performs a read-modify-write, the lock must be held
+func (m *Map) update(reg *Register, mask, value uint64) error {
+	old, err := m.read(reg)
+	if err != nil {
+		return err
+	}
+	return m.write(reg, old&^mask|value&mask)
+}
+
+// read fetches a register, the lock must be held
+func (m *Map) read(reg *Register) (uint64, error) {
+	if reg.WriteOnly {
+		value, ok := m.cache[reg.Name]
+		if !ok {
+			return 0, fmt.Errorf("%w: %q", ErrNotCached, reg.Name)
+		}
+		return value, nil
+	}
+
+	wire := make([]byte, reg.wireLen())
+	if err := m.conn.Tx(reg.addrBytes(reg.Addr), wire); err != nil {
+		return 0, fmt.Errorf("regmap: read %q: %w", reg.Name, err)
+	}
+	data, err := reg.checkCRC(wire)
+	if err != nil {
+		return 0, err
+	}
+	return reg.decode(data), nil
+}
+
+// write stores a register, the lock must be held
+func (m *Map) write(reg *Register, value uint64) error {
+	if reg.ReadOnly {
+		return fmt.Errorf("regmap: register %q is read-only", reg.Name)
+	}
+	if reg.Width < 8 && value >= 1<<(8*reg.Width) {
+		return fmt.Errorf("regmap: value %#x does not fit in %q", value, reg.Name)
+	}
+
+	addr := reg.Addr
+	if reg.WriteAddr != 0 {
+		addr = reg.WriteAddr
+	}
+	buf := append(reg.addrBytes(addr), reg.addCRC(reg.encode(value))...)
+	if _, err := m.conn.Write(buf); err != nil {
+		return fmt.Errorf("regmap: write %q: %w", reg.Name, err)
+	}
+	if reg.WriteOnly {
+		m.cache[reg.Name] = value
+	}
+	return nil
+}
+
+// addrBytes returns a register address as sent on the wire
+func (r *Register) addrBytes(addr uint16) []byte {
+	if r.AddrWidth == 2 {
+		return []byte{byte(addr >> 8), byte(addr)}
+	}
+	return []byte{byte(addr)}
+}
+
+// wireLen returns the length of the value on the wire, CRCs included
+func (r *Register) wireLen() int {
+	if r.CRC != nil {
+		return r.Width / 2 * 3
+	}
+	return r.Width
+}
+
+// checkCRC verifies and strips the CRC bytes of a value
+func (r *Register) checkCRC(wire []byte) ([]byte, error) {
+	if r.CRC == nil {
+		return wire, nil
+	}
+	data := make([]byte, 0, r.Width)
+	for i := 0; i < len(wire); i += 3 {
+		if got, want := wire[i+2], r.CRC(wire[i:i+2]); got != want {
+			return nil, fmt.Errorf("%w: register %q: got %#02x, want %#02x", ErrCRC, r.Name, got, want)
+		}
+		data = append(data, wire[i], wire[i+1])
+	}
+	return data, nil
+}
+
+// addCRC inserts the CRC bytes of a value
+func (r *Register) addCRC(data []byte) []byte {
+	if r.CRC == nil {
+		return data
+	}
+	wire := make([]byte, 0, r.wireLen())
+	for i := 0; i < len(data); i += 2 {
+		wire = append(wire, data[i], data[i+1], r.CRC(data[i:i+2]))
+	}
+	return wire
+}
+
+// decode converts the bytes of a value to an integer
+func (r *Register) decode(data []byte) uint64 {
+	var value uint64
+	for i := range data {
+		b := data[i]
+		if r.LittleEndian {
+			b = data[len(data)-1-i]
+		}
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// encode converts an integer to the bytes of a value
+func (r *Register) encode(value uint64) []byte {
+	data := make([]byte, r.Width)
+	for i := range data {
+		b := byte(value >> (8 * (r.Width - 1 - i)))
+		if r.LittleEndian {
+			data[r.Width-1-i] = b
+		} else {
+			data[i] = b
+		}
+	}
+	return data
+}
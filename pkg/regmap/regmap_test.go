@@ -0,0 +1,118 @@
+package regmap
+
+import (
+	"errors"
+	"testing"
+
+	"dev/pkg/i2c/sim"
+)
+
+// memory is a chip with 8-bit addressed registers and an auto-incremented pointer
+type memory struct {
+	regs [256]byte
+	ptr  byte
+}
+
+func (m *memory) Write(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	m.ptr = data[0]
+	for _, b := range data[1:] {
+		m.regs[m.ptr] = b
+		m.ptr++
+	}
+	return nil
+}
+
+func (m *memory) Read(buf []byte) error {
+	for i := range buf {
+		buf[i] = m.regs[m.ptr]
+		m.ptr++
+	}
+	return nil
+}
+
+func newMap(t *testing.T) (*Map, *memory) {
+	t.Helper()
+	bus := sim.NewBus()
+	chip := &memory{}
+	bus.Attach(0x76, chip)
+	conn, _ := bus.Open(0x76)
+	m, err := New(conn,
+		Register{Name: "id", Addr: 0xD0, ReadOnly: true},
+		Register{Name: "ctrl", Addr: 0xF4, Fields: []Field{
+			{Name: "mode", Shift: 0, Width: 2},
+			{Name: "osrs_p", Shift: 2, Width: 3},
+			{Name: "osrs_t", Shift: 5, Width: 3},
+		}},
+		Register{Name: "calib", Addr: 0x88, Width: 2, LittleEndian: true},
+		Register{Name: "reset", Addr: 0xE0, WriteOnly: true},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, chip
+}
+
+func TestFields(t *testing.T) {
+	m, chip := newMap(t)
+	chip.regs[0xD0] = 0x60
+	chip.regs[0x88] = 0x70
+	chip.regs[0x89] = 0x6B
+
+	if id, err := m.Read("id"); err != nil || id != 0x60 {
+		t.Errorf("id = %#x, %v, want 0x60", id, err)
+	}
+	if err := m.Write("id", 0); err == nil {
+		t.Error("wrote a read-only register")
+	}
+	if calib, err := m.Read("calib"); err != nil || calib != 0x6B70 {
+		t.Errorf("calib = %#x, %v, want 0x6b70", calib, err)
+	}
+
+	if err := m.Set("ctrl", "osrs_t", 0x1); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set("ctrl", "mode", 0x3); err != nil {
+		t.Fatal(err)
+	}
+	if chip.regs[0xF4] != 0x23 {
+		t.Errorf("ctrl = %#x, want 0x23", chip.regs[0xF4])
+	}
+	if mode, err := m.Get("ctrl", "mode"); err != nil || mode != 0x3 {
+		t.Errorf("mode = %#x, %v, want 0x3", mode, err)
+	}
+	if err := m.Set("ctrl", "mode", 0x4); err == nil {
+		t.Error("set a value too large for its field")
+	}
+}
+
+func TestWriteOnly(t *testing.T) {
+	m, chip := newMap(t)
+
+	if _, err := m.Read("reset"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("got %v, want ErrNotCached", err)
+	}
+	if err := m.Write("reset", 0xB6); err != nil {
+		t.Fatal(err)
+	}
+	chip.regs[0xE0] = 0 // The chip reads back zero
+	if v, err := m.Read("reset"); err != nil || v != 0xB6 {
+		t.Errorf("reset = %#x, %v, want the cached 0xb6", v, err)
+	}
+}
+
+func TestDeclarationErrors(t *testing.T) {
+	bad := []Register{
+		{Name: "wide", Width: 9},
+		{Name: "crc", Width: 1, CRC: func([]byte) uint8 { return 0 }},
+		{Name: "overlap", Fields: []Field{{Name: "a", Shift: 0, Width: 4}, {Name: "b", Shift: 3, Width: 2}}},
+		{Name: "outside", Fields: []Field{{Name: "a", Shift: 6, Width: 4}}},
+	}
+	for _, reg := range bad {
+		if _, err := New(nil, reg); err == nil {
+			t.Errorf("register %q accepted", reg.Name)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package sht31
+
+import (
+	"fmt"
+	"math"
+)
+
+// AlertLimit selects one of the four limits driving the ALERT pin. An alert
+// is raised when humidity or temperature goes past a set limit, and cleared
+// once back within the clear limits.
+type AlertLimit int
+
+const (
+	AlertHighSet AlertLimit = iota
+	AlertHighClear
+	AlertLowClear
+	AlertLowSet
+)
+
+// limitRegisters are the registers of the alert limits
+var limitRegisters = [...]string{
+	AlertHighSet:   "alert_high_set",
+	AlertHighClear: "alert_high_clear",
+	AlertLowClear:  "alert_low_clear",
+	AlertLowSet:    "alert_low_set",
+}
+
+// Limit is an alert limit. The sensor stores it with a resolution of about
+// 0.8 %RH and 0.35 °C.
+type Limit struct {
+	Temperature float64 // °C
+	Humidity    float64 // %RH
+}
+
+// Alerts are the alert bits of the status register
+type Alerts struct {
+	Pending     bool // An alert was raised since the status was last cleared
+	Humidity    bool // Humidity is past its limits
+	Temperature bool // Temperature is past its limits
+}
+
+/////////////////////////////////////////////////////////
+//
+// # Alert Functions
+//
+////////////////////////////////////////////////////////
+
+// AlertLimit reads an alert limit
+func (s *SHT31) AlertLimit(limit AlertLimit) (Limit, error) {
+	if limit < AlertHighSet || limit > AlertLowSet {
+		return Limit{}, fmt.Errorf("sht31: invalid alert limit %d", limit)
+	}
+	word, err := s.regs.Read(limitRegisters[limit])
+	if err != nil {
+		return Limit{}, wrapErr(err)
+	}
+	return unpackLimit(uint16(word)), nil
+}
+
+// SetAlertLimit writes an alert limit, rounded to the sensor resolution.
+// The limits are back to their defaults after a reset. The sensor only
+// checks them in periodic mode, see StartPeriodic.
+func (s *SHT31) SetAlertLimit(limit AlertLimit, l Limit) error {
+	if limit < AlertHighSet || limit > AlertLowSet {
+		return fmt.Errorf("sht31: invalid alert limit %d", limit)
+	}
+	word, err := packLimit(l)
+	if err != nil {
+		return err
+	}
+	return wrapErr(s.regs.Write(limitRegisters[limit], uint64(word)))
+}
+
+// Alerts reads the alert bits of the status register. They are only
+// updated by periodic measurements, single shots leave them alone.
+func (s *SHT31) Alerts() (Alerts, error) {
+	stat, err := s.DecodedStatus()
+	if err != nil {
+		return Alerts{}, err
+	}
+	return Alerts{Pending: stat.AlertPending, Humidity: stat.RHAlert, Temperature: stat.TAlert}, nil
+}
+
+// ClearStatus clears the alert and reset flags of the status register
+func (s *SHT31) ClearStatus() error {
+	_, err := s.WriteCommand(SHT31ClearStatus)
+	return err
+}
+
+////////////////////////////////////////////////////////
+//
+// # Private Functions
+//
+////////////////////////////////////////////////////////
+
+// packLimit converts a limit to its 16-bit format: the 7 most significant
+// bits of the raw humidity followed by the 9 of the raw temperature
+func packLimit(l Limit) (uint16, error) {
+	if l.Temperature < -45 || l.Temperature > 130 || math.IsNaN(l.Temperature) {
+		return 0, fmt.Errorf("sht31: alert temperature %.2f °C out of range", l.Temperature)
+	}
+	if l.Humidity < 0 || l.Humidity > 100 || math.IsNaN(l.Humidity) {
+		return 0, fmt.Errorf("sht31: alert humidity %.2f %% out of range", l.Humidity)
+	}
+	rh := math.Min(math.Round(l.Humidity/100*65535/(1<<9)), 0x7F)
+	t := math.Min(math.Round((l.Temperature+45)/175*65535/(1<<7)), 0x1FF)
+	return uint16(rh)<<9 | uint16(t), nil
+}
+
+// unpackLimit converts a limit from its 16-bit format
+func unpackLimit(word uint16) Limit {
+	rh := float64(word & 0xFE00)
+	t := float64(word&0x01FF) * (1 << 7)
+	return Limit{
+		Temperature: -45 + 175*t/65535,
+		Humidity:    100 * rh / 65535,
+	}
+}
@@ -0,0 +1,85 @@
+package sht31
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLimitPacking(t *testing.T) {
+	// Power-up limits of the datasheet
+	for _, word := range []uint16{0xCD33, 0xC92D, 0x3869, 0x3466} {
+		got, err := packLimit(unpackLimit(word))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != word {
+			t.Errorf("got %#04x after a round trip, want %#04x", got, word)
+		}
+	}
+	if _, err := packLimit(Limit{Temperature: 25, Humidity: 101}); err == nil {
+		t.Error("humidity above 100 % accepted")
+	}
+}
+
+func TestAlerts(t *testing.T) {
+	sensor, model := newSimSensor(t, nil)
+
+	l, err := sensor.AlertLimit(AlertHighSet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(l.Humidity-80) > 0.8 || math.Abs(l.Temperature-60) > 0.35 {
+		t.Errorf("got high set limit %+v, want 80 %%RH 60 °C", l)
+	}
+
+	limits := map[AlertLimit]Limit{
+		AlertHighSet:   {Temperature: 40, Humidity: 60},
+		AlertHighClear: {Temperature: 38, Humidity: 55},
+	}
+	for limit, want := range limits {
+		if err := sensor.SetAlertLimit(limit, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := sensor.AlertLimit(limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if math.Abs(got.Humidity-want.Humidity) > 0.8 || math.Abs(got.Temperature-want.Temperature) > 0.35 {
+			t.Errorf("limit %d: got %+v, want %+v", limit, got, want)
+		}
+	}
+	if status := model.Status(); status&1 != 0 {
+		t.Error("checksum of the limit write failed")
+	}
+
+	if err := sensor.ClearStatus(); err != nil {
+		t.Fatal(err)
+	}
+	model.Set(25, 70)
+	sensor.Measure()
+	if alerts, err := sensor.Alerts(); err != nil || alerts != (Alerts{}) {
+		t.Errorf("got %+v %v after a single shot, want no alert", alerts, err)
+	}
+
+	if err := sensor.StartPeriodic(Rate10, RepeatabilityHigh); err != nil {
+		t.Fatal(err)
+	}
+	defer sensor.Stop()
+	time.Sleep(Rate10.Period())
+	if _, _, err := sensor.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if alerts, err := sensor.Alerts(); err != nil || alerts != (Alerts{Pending: true, Humidity: true}) {
+		t.Errorf("got %+v %v, want a pending humidity alert", alerts, err)
+	}
+
+	model.Set(25, 50)
+	time.Sleep(Rate10.Period())
+	if _, _, err := sensor.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	if alerts, err := sensor.Alerts(); err != nil || alerts != (Alerts{Pending: true}) {
+		t.Errorf("got %+v %v, want the humidity alert cleared, still pending", alerts, err)
+	}
+}
@@ -0,0 +1,181 @@
+package sht31
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Rate of the periodic mode, in measurements per second (mps)
+type Rate int
+
+const (
+	Rate0_5 Rate = iota // 0.5 mps
+	Rate1               // 1 mps
+	Rate2               // 2 mps
+	Rate4               // 4 mps
+	Rate10              // 10 mps
+)
+
+// periodicCommands starts the periodic mode, by rate and repeatability
+var periodicCommands = [...][3]uint16{
+	Rate0_5: {0x2032, 0x2024, 0x202F},
+	Rate1:   {0x2130, 0x2126, 0x212D},
+	Rate2:   {0x2236, 0x2220, 0x222B},
+	Rate4:   {0x2334, 0x2322, 0x2329},
+	Rate10:  {0x2737, 0x2721, 0x272A},
+}
+
+// Period returns the time between two measurements
+func (r Rate) Period() time.Duration {
+	switch r {
+	case Rate0_5:
+		return 2 * time.Second
+	case Rate1:
+		return time.Second
+	case Rate2:
+		return 500 * time.Millisecond
+	case Rate4:
+		return 250 * time.Millisecond
+	}
+	return 100 * time.Millisecond
+}
+
+// artPeriod is the measurement period of the ART mode
+const artPeriod = 250 * time.Millisecond
+
+// Reading is a measurement of the periodic mode
+type Reading struct {
+	Time        time.Time
+	Temperature float64 // °C, NaN when Err is set
+	Humidity    float64 // %, NaN when Err is set
+	Err         error
+}
+
+/////////////////////////////////////////////////////////
+//
+// # Periodic Mode Functions
+//
+////////////////////////////////////////////////////////
+
+// StartPeriodic starts measuring at the given rate. The measurements are
+// then read with Fetch, until Stop. The sensor only accepts a few commands
+// in this mode: single shot measurements fail with ErrNACK.
+func (s *SHT31) StartPeriodic(rate Rate, rep Repeatability) error {
+	command, err := periodicCommand(rate, rep)
+	if err != nil {
+		return err
+	}
+	_, err = s.WriteCommand(command)
+	return err
+}
+
+// StartART starts the periodic mode with accelerated response time, which
+// measures at 4 mps
+func (s *SHT31) StartART() error {
+	_, err := s.WriteCommand(SHT31PeriodicART)
+	return err
+}
+
+// Fetch reads the last measurement of the periodic mode. It fails with
+// ErrNoData when none was made since the previous fetch.
+func (s *SHT31) Fetch() (float64, float64, error) {
+	if _, err := s.WriteCommand(SHT31FetchData); err != nil {
+		return math.NaN(), math.NaN(), err
+	}
+	readBuffer := make([]byte, 6)
+	n, err := s.fd.Read(readBuffer)
+	if err != nil {
+		err = wrapErr(err)
+		if errors.Is(err, ErrNACK) {
+			// The read is NACKed until a new measurement is done
+			err = fmt.Errorf("%w: %w", ErrNoData, err)
+		}
+		return math.NaN(), math.NaN(), err
+	}
+	if err := s.decode(readBuffer[:n]); err != nil {
+		return math.NaN(), math.NaN(), err
+	}
+	return s.temp, s.humidity, nil
+}
+
+// Stop stops the periodic mode and waits for the sensor to be idle
+func (s *SHT31) Stop() error {
+	if _, err := s.WriteCommand(SHT31Break); err != nil {
+		return err
+	}
+	time.Sleep(1 * time.Millisecond)
+	return nil
+}
+
+// Stream starts the periodic mode and sends each measurement on the returned
+// channel, failed ones with Err set, until ctx is done. The periodic mode is
+// then stopped and the channel closed. The sensor must not be used for
+// anything else meanwhile.
+func (s *SHT31) Stream(ctx context.Context, rate Rate, rep Repeatability) (<-chan Reading, error) {
+	command, err := periodicCommand(rate, rep)
+	if err != nil {
+		return nil, err
+	}
+	return s.stream(ctx, command, rate.Period())
+}
+
+// StreamART is Stream in ART mode, at 4 mps
+func (s *SHT31) StreamART(ctx context.Context) (<-chan Reading, error) {
+	return s.stream(ctx, SHT31PeriodicART, artPeriod)
+}
+
+////////////////////////////////////////////////////////
+//
+// # Private Functions
+//
+////////////////////////////////////////////////////////
+
+// periodicCommand returns the command starting the periodic mode
+func periodicCommand(rate Rate, rep Repeatability) (uint16, error) {
+	if rate < Rate0_5 || rate > Rate10 {
+		return 0, fmt.Errorf("sht31: invalid rate %d", rate)
+	}
+	if rep < RepeatabilityHigh || rep > RepeatabilityLow {
+		return 0, fmt.Errorf("sht31: invalid repeatability %d", rep)
+	}
+	return periodicCommands[rate][rep], nil
+}
+
+// stream starts the periodic mode with command and fetches a measurement
+// every period
+func (s *SHT31) stream(ctx context.Context, command uint16, period time.Duration) (<-chan Reading, error) {
+	if err := s.writeCommandContext(ctx, command); err != nil {
+		return nil, wrapErr(err)
+	}
+
+	readings := make(chan Reading)
+	go func() {
+		defer close(readings)
+		defer s.Stop()
+
+		ticker := time.NewTicker(period)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			temp, hum, err := s.Fetch()
+			if errors.Is(err, ErrNoData) {
+				continue // Polled a bit early, the next tick gets it
+			}
+			reading := Reading{Time: time.Now(), Temperature: temp, Humidity: hum, Err: err}
+			select {
+			case readings <- reading:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return readings, nil
+}
@@ -0,0 +1,83 @@
+package sht31
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPeriodic(t *testing.T) {
+	sensor, model := newSimSensor(t, nil)
+
+	if err := sensor.StartPeriodic(Rate10, RepeatabilityMedium); err != nil {
+		t.Fatal(err)
+	}
+	if !model.Periodic() {
+		t.Fatal("periodic mode not started")
+	}
+	if _, _, err := sensor.Fetch(); !errors.Is(err, ErrNoData) {
+		t.Errorf("got %v before the first measurement, want ErrNoData", err)
+	}
+	if _, _, err := sensor.Measure(); !errors.Is(err, ErrNACK) {
+		t.Errorf("got %v for a single shot in periodic mode, want ErrNACK", err)
+	}
+
+	time.Sleep(Rate10.Period())
+	temp, hum, err := sensor.Fetch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(temp-21.5) > 0.02 || math.Abs(hum-48.25) > 0.02 {
+		t.Errorf("got %.2f °C %.2f %%, want 21.50 °C 48.25 %%", temp, hum)
+	}
+
+	if err := sensor.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if model.Periodic() {
+		t.Error("periodic mode not stopped")
+	}
+	if _, _, err := sensor.Measure(); err != nil {
+		t.Errorf("single shot after Stop: %v", err)
+	}
+
+	if err := sensor.StartPeriodic(Rate(7), RepeatabilityHigh); err == nil {
+		t.Error("invalid rate accepted")
+	}
+}
+
+func TestStream(t *testing.T) {
+	sensor, model := newSimSensor(t, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	readings, err := sensor.Stream(ctx, Rate10, RepeatabilityHigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var last time.Time
+	for i := 0; i < 3; i++ {
+		model.Set(20+float64(i), 50)
+		r := <-readings
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if !r.Time.After(last) {
+			t.Error("readings are not timestamped in order")
+		}
+		last = r.Time
+		if math.Abs(r.Temperature-(20+float64(i))) > 0.02 {
+			t.Errorf("reading %d: got %.2f °C, want %.2f °C", i, r.Temperature, 20+float64(i))
+		}
+	}
+
+	cancel()
+	for range readings {
+	}
+	if model.Periodic() {
+		t.Error("periodic mode not stopped after cancel")
+	}
+}
@@ -1,10 +1,15 @@
 package sht31
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math"
+	"syscall"
 	"time"
 
 	"dev/pkg/i2c"
+	"dev/pkg/regmap"
 )
 
 const (
@@ -20,10 +25,207 @@ const (
 	SHT31SoftReset          = 0x30A2 // Soft Reset
 	SHT31HeaterEn           = 0x306D // Heater Enable
 	SHT31HeaterDis          = 0x3066 // Heater Disable
+	SHT31PeriodicART        = 0x2B32 // Periodic Measurement with Accelerated Response Time (4 mps)
+	SHT31FetchData          = 0xE000 // Fetch Data of a Periodic Measurement
+	SHT31Break              = 0x3093 // Break, stops the Periodic Measurement
+	SHT31AlertReadHighSet   = 0xE11F // Read High Alert Limit, Set
+	SHT31AlertReadHighClr   = 0xE114 // Read High Alert Limit, Clear
+	SHT31AlertReadLowClr    = 0xE109 // Read Low Alert Limit, Clear
+	SHT31AlertReadLowSet    = 0xE102 // Read Low Alert Limit, Set
+	SHT31AlertWriteHighSet  = 0x611D // Write High Alert Limit, Set
+	SHT31AlertWriteHighClr  = 0x6116 // Write High Alert Limit, Clear
+	SHT31AlertWriteLowClr   = 0x610B // Write Low Alert Limit, Clear
+	SHT31AlertWriteLowSet   = 0x6100 // Write Low Alert Limit, Set
+	SHT31ReadSerial         = 0x3780 // Read Serial Number with Clock Stretch Disabled
+	SHT31ReadSerialStretch  = 0x3682 // Read Serial Number with Clock Stretch Enabled
 	SHT31RegHeaterBit       = 0x0D   // Status Register Heater Bit
 )
 
+// Repeatability of a measurement: the higher, the less noisy and the longer
+type Repeatability int
+
+const (
+	RepeatabilityHigh Repeatability = iota
+	RepeatabilityMedium
+	RepeatabilityLow
+)
+
+// singleShotCommands are the single shot measurement commands, by clock
+// stretching and repeatability
+var singleShotCommands = [2][3]uint16{
+	{SHT31MeasHighRep, SHT31MeasMedRep, SHT31MeasLowRep},
+	{SHT31MeasHighRepStretch, SHT31MeasMedRepStretch, SHT31MeasLowRepStretch},
+}
+
+// Duration returns the longest a measurement takes, as given by the datasheet
+func (r Repeatability) Duration() time.Duration {
+	switch r {
+	case RepeatabilityMedium:
+		return 6500 * time.Microsecond
+	case RepeatabilityLow:
+		return 4500 * time.Microsecond
+	}
+	return 15500 * time.Microsecond
+}
+
+// Option configures the sensor created by NewSHT31
+type Option func(*SHT31) error
+
+// WithRepeatability sets the repeatability of single shot measurements,
+// high by default
+func WithRepeatability(rep Repeatability) Option {
+	return func(s *SHT31) error {
+		if rep < RepeatabilityHigh || rep > RepeatabilityLow {
+			return fmt.Errorf("sht31: invalid repeatability %d", rep)
+		}
+		s.rep = rep
+		return nil
+	}
+}
+
+// WithClockStretching makes the sensor hold the clock low until a single
+// shot measurement is done, so that it is read back without waiting for the
+// measurement duration. The adapter must support clock stretching.
+func WithClockStretching(enable bool) Option {
+	return func(s *SHT31) error {
+		s.stretch = enable
+		return nil
+	}
+}
+
+// limitFields are the fields of an alert limit: the 7 most significant bits
+// of the raw humidity and the 9 most significant bits of the raw temperature
+var limitFields = []regmap.Field{
+	{Name: "humidity", Shift: 9, Width: 7},
+	{Name: "temperature", Shift: 0, Width: 9},
+}
+
+// registers of the SHT31, each read and written with its own commands
+var registers = []regmap.Register{
+	{
+		Name:      "status",
+		Addr:      SHT31ReadStatus,
+		AddrWidth: 2,
+		Width:     2,
+		ReadOnly:  true,
+		CRC:       crc8,
+		Fields: []regmap.Field{
+			{Name: "alert", Shift: 15, Width: 1},
+			{Name: "heater", Shift: SHT31RegHeaterBit, Width: 1},
+			{Name: "rh_alert", Shift: 11, Width: 1},
+			{Name: "t_alert", Shift: 10, Width: 1},
+			{Name: "reset", Shift: 4, Width: 1},
+			{Name: "command", Shift: 1, Width: 1},
+			{Name: "checksum", Shift: 0, Width: 1},
+		},
+	},
+	{Name: "alert_high_set", Addr: SHT31AlertReadHighSet, WriteAddr: SHT31AlertWriteHighSet, AddrWidth: 2, Width: 2, CRC: crc8, Fields: limitFields},
+	{Name: "alert_high_clear", Addr: SHT31AlertReadHighClr, WriteAddr: SHT31AlertWriteHighClr, AddrWidth: 2, Width: 2, CRC: crc8, Fields: limitFields},
+	{Name: "alert_low_clear", Addr: SHT31AlertReadLowClr, WriteAddr: SHT31AlertWriteLowClr, AddrWidth: 2, Width: 2, CRC: crc8, Fields: limitFields},
+	{Name: "alert_low_set", Addr: SHT31AlertReadLowSet, WriteAddr: SHT31AlertWriteLowSet, AddrWidth: 2, Width: 2, CRC: crc8, Fields: limitFields},
+}
+
+// Errors of the SHT31 API, wrapping the underlying error if any
+var (
+	ErrCRC       = errors.New("sht31: CRC mismatch")
+	ErrShortRead = errors.New("sht31: short read")
+	ErrNACK      = errors.New("sht31: not acknowledged")
+	ErrTimeout   = errors.New("sht31: timeout")
+	ErrNoData    = errors.New("sht31: no new measurement")
+)
+
+// Status is the decoded status register
+type Status struct {
+	Raw            uint16
+	AlertPending   bool // An alert was raised since the status was last cleared
+	Heater         bool // The heater is on
+	RHAlert        bool // Humidity is past its alert limits
+	TAlert         bool // Temperature is past its alert limits
+	ResetDetected  bool // A reset happened since the status was last cleared
+	CommandFailed  bool // The last command was not processed
+	ChecksumFailed bool // The checksum of the last write was wrong
+}
+
+// Fields of the status register, looked up once in its declaration. A
+// field missing from it would decode as always clear, which TestStatusFields
+// rules out.
+var (
+	statusAlert    = statusField("alert")
+	statusHeater   = statusField("heater")
+	statusRHAlert  = statusField("rh_alert")
+	statusTAlert   = statusField("t_alert")
+	statusReset    = statusField("reset")
+	statusCommand  = statusField("command")
+	statusChecksum = statusField("checksum")
+)
+
+// statusField returns a field of the status register declaration
+func statusField(name string) regmap.Field {
+	for i := range registers {
+		if registers[i].Name == "status" {
+			f, _ := registers[i].Field(name)
+			return f
+		}
+	}
+	return regmap.Field{}
+}
+
+// ParseStatus decodes a raw status register
+func ParseStatus(raw uint16) Status {
+	bit := func(f regmap.Field) bool { return f.Get(uint64(raw)) != 0 }
+	return Status{
+		Raw:            raw,
+		AlertPending:   bit(statusAlert),
+		Heater:         bit(statusHeater),
+		RHAlert:        bit(statusRHAlert),
+		TAlert:         bit(statusTAlert),
+		ResetDetected:  bit(statusReset),
+		CommandFailed:  bit(statusCommand),
+		ChecksumFailed: bit(statusChecksum),
+	}
+}
+
+// String lists the flags set
+func (st Status) String() string {
+	flags := []struct {
+		set  bool
+		name string
+	}{
+		{st.AlertPending, "alert pending"},
+		{st.Heater, "heater on"},
+		{st.RHAlert, "RH alert"},
+		{st.TAlert, "T alert"},
+		{st.ResetDetected, "reset detected"},
+		{st.CommandFailed, "command failed"},
+		{st.ChecksumFailed, "checksum failed"},
+	}
+	out := fmt.Sprintf("%#04x", st.Raw)
+	for _, f := range flags {
+		if f.set {
+			out += ", " + f.name
+		}
+	}
+	return out
+}
+
+// Sensor is the SHT31 API reporting why an operation failed
+type Sensor interface {
+	Status() (uint16, error)
+	DecodedStatus() (Status, error)
+	ReadSerial() (uint32, error)
+	SoftReset() error
+	SetHeater(enable bool) error
+	HeaterEnabled() (bool, error)
+	Temperature() (float64, error)
+	Humidity() (float64, error)
+	Measure() (float64, float64, error)
+	MeasureContext(ctx context.Context) (float64, float64, error)
+}
+
 // SHT31Interface defines the methods for interacting with the SHT31 sensor.
+//
+// Deprecated: failures are only reported as zero, false or NaN values, use
+// Sensor instead.
 type SHT31Interface interface {
 	ReadStatus() uint16
 	Reset()
@@ -36,11 +238,20 @@ type SHT31Interface interface {
 
 // SHT31 represents the SHT31 sensor
 type SHT31 struct {
-	fd       *i2c.I2CDevice
+	fd       i2c.Conn
+	regs     *regmap.Map
+	retry    i2c.RetryPolicy
+	rep      Repeatability
+	stretch  bool
 	humidity float64
 	temp     float64
 }
 
+var (
+	_ Sensor         = (*SHT31)(nil)
+	_ SHT31Interface = (*SHT31)(nil)
+)
+
 /////////////////////////////////////////////////////////
 //
 // # Declaration Functions
@@ -48,12 +259,27 @@ type SHT31 struct {
 ////////////////////////////////////////////////////////
 
 // SHT31 creates a new instance of the SHT31 sensor
-func NewSHT31(fd *i2c.I2CDevice) *SHT31 {
-	return &SHT31{
+func NewSHT31(fd i2c.Conn, opts ...Option) (*SHT31, error) {
+	if err := i2c.Require(fd, i2c.I2C_FUNC_I2C); err != nil {
+		return nil, fmt.Errorf("sht31: %w", err)
+	}
+	regs, err := regmap.New(fd, registers...)
+	if err != nil {
+		return nil, err
+	}
+	s := &SHT31{
 		fd:       fd,
+		regs:     regs,
+		retry:    i2c.DefaultRetryPolicy,
 		humidity: math.NaN(),
 		temp:     math.NaN(),
 	}
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
 }
 
 /////////////////////////////////////////////////////////
@@ -62,81 +288,231 @@ func NewSHT31(fd *i2c.I2CDevice) *SHT31 {
 //
 ////////////////////////////////////////////////////////
 
-// ReadStatus gets the current status register contents
-func (s *SHT31) ReadStatus() uint16 {
-	s.WriteCommand(SHT31ReadStatus)
+// Status reads the status register
+func (s *SHT31) Status() (uint16, error) {
+	stat, err := s.regs.Read("status")
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	return uint16(stat), nil
+}
+
+// DecodedStatus reads and decodes the status register
+func (s *SHT31) DecodedStatus() (Status, error) {
+	stat, err := s.Status()
+	if err != nil {
+		return Status{}, err
+	}
+	return ParseStatus(stat), nil
+}
+
+// ReadSerial reads the unique serial number of the sensor
+func (s *SHT31) ReadSerial() (uint32, error) {
+	command := uint16(SHT31ReadSerial)
+	if s.stretch {
+		command = SHT31ReadSerialStretch
+	}
+	if _, err := s.WriteCommand(command); err != nil {
+		return 0, err
+	}
+	if !s.stretch {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	readBuffer := make([]byte, 6)
+	n, err := s.fd.Read(readBuffer)
+	if err != nil {
+		return 0, wrapErr(err)
+	}
+	if n != len(readBuffer) {
+		return 0, fmt.Errorf("%w: %d bytes out of %d", ErrShortRead, n, len(readBuffer))
+	}
+	if readBuffer[2] != crc8(readBuffer[:2]) || readBuffer[5] != crc8(readBuffer[3:5]) {
+		return 0, ErrCRC
+	}
+	return uint32(readBuffer[0])<<24 | uint32(readBuffer[1])<<16 | uint32(readBuffer[3])<<8 | uint32(readBuffer[4]), nil
+}
+
+// SoftReset resets the sensor and waits for it to be back
+func (s *SHT31) SoftReset() error {
+	if _, err := s.WriteCommand(SHT31SoftReset); err != nil {
+		return err
+	}
+	time.Sleep(10 * time.Millisecond)
+	return nil
+}
 
-	data := make([]byte, 3)
-	s.fd.Read(data)
+// Reinit soft-resets the sensor, e.g. once its bus has been reconnected
+func (s *SHT31) Reinit() error {
+	return s.SoftReset()
+}
+
+// SetHeater enables or disables the heating element
+func (s *SHT31) SetHeater(enable bool) error {
+	command := uint16(SHT31HeaterDis)
+	if enable {
+		command = SHT31HeaterEn
+	}
+	if _, err := s.WriteCommand(command); err != nil {
+		return err
+	}
+	time.Sleep(1 * time.Millisecond)
+	return nil
+}
+
+// HeaterEnabled reads the heater state from the status register
+func (s *SHT31) HeaterEnabled() (bool, error) {
+	enabled, err := s.regs.GetBool("status", "heater")
+	if err != nil {
+		return false, wrapErr(err)
+	}
+	return enabled, nil
+}
+
+// Temperature measures the temperature in °C
+func (s *SHT31) Temperature() (float64, error) {
+	temp, _, err := s.Measure()
+	return temp, err
+}
+
+// Humidity measures the relative humidity in %
+func (s *SHT31) Humidity() (float64, error) {
+	_, hum, err := s.Measure()
+	return hum, err
+}
 
-	stat := uint16(data[0])<<8 | uint16(data[1])
+// Measure measures both temperature and relative humidity
+func (s *SHT31) Measure() (float64, float64, error) {
+	return s.MeasureContext(context.Background())
+}
+
+// MeasureContext measures both temperature and relative humidity, giving up
+// with ErrTimeout when ctx expires
+func (s *SHT31) MeasureContext(ctx context.Context) (float64, float64, error) {
+	if err := s.readTempHum(ctx); err != nil {
+		return math.NaN(), math.NaN(), wrapErr(err)
+	}
+	return s.temp, s.humidity, nil
+}
+
+// SetRetryPolicy sets how transfers failing with a transient error are retried
+func (s *SHT31) SetRetryPolicy(policy i2c.RetryPolicy) {
+	s.retry = policy
+}
+
+// WriteCommand performs an I2C write with the given command
+func (s *SHT31) WriteCommand(command uint16) (int, error) {
+	cmd := []byte{byte(command >> 8), byte(command & 0xFF)}
+	n, err := s.fd.Write(cmd)
+	return n, wrapErr(err)
+}
+
+/////////////////////////////////////////////////////////
+//
+// # Legacy Functions
+//
+////////////////////////////////////////////////////////
+
+// ReadStatus gets the current status register contents, 0 on failure
+func (s *SHT31) ReadStatus() uint16 {
+	stat, _ := s.Status()
 	return stat
 }
 
 // Reset performs a reset of the sensor
 func (s *SHT31) Reset() {
-	s.WriteCommand(SHT31SoftReset)
-	time.Sleep(10 * time.Millisecond)
+	s.SoftReset()
 }
 
 // Heater enables or disables the heating element
 func (s *SHT31) Heater(enable bool) {
-	if enable {
-		s.WriteCommand(SHT31HeaterEn)
-	} else {
-		s.WriteCommand(SHT31HeaterDis)
-	}
-	time.Sleep(1 * time.Millisecond)
+	s.SetHeater(enable)
 }
 
-// IsHeaterEnabled returns the heater state
+// IsHeaterEnabled returns the heater state, false on failure
 func (s *SHT31) IsHeaterEnabled() bool {
-	regValue := s.ReadStatus()
-	return (regValue>>SHT31RegHeaterBit)&1 == 1
+	enabled, _ := s.HeaterEnabled()
+	return enabled
 }
 
-// ReadTemperature gets a single temperature reading
+// ReadTemperature gets a single temperature reading, NaN on failure
 func (s *SHT31) ReadTemperature() float64 {
-	if !s.ReadTempHum() {
-		return math.NaN()
-	}
-	return s.temp
+	temp, _ := s.Temperature()
+	return temp
 }
 
-// ReadHumidity gets a single relative humidity reading
+// ReadHumidity gets a single relative humidity reading, NaN on failure
 func (s *SHT31) ReadHumidity() float64 {
-	if !s.ReadTempHum() {
-		return math.NaN()
-	}
-	return s.humidity
+	hum, _ := s.Humidity()
+	return hum
 }
 
 // ReadBoth gets a reading of both temperature and relative humidity
 func (s *SHT31) ReadBoth() (float64, float64, bool) {
-	if !s.ReadTempHum() {
-		return math.NaN(), math.NaN(), false
-	}
-	return s.temp, s.humidity, true
+	temp, hum, err := s.Measure()
+	return temp, hum, err == nil
+}
+
+// ReadBothContext gets a reading of both temperature and relative humidity,
+// giving up when ctx is done. It is the same as MeasureContext.
+func (s *SHT31) ReadBothContext(ctx context.Context) (float64, float64, error) {
+	return s.MeasureContext(ctx)
 }
 
 // ReadTempHum reads temperature and humidity
 func (s *SHT31) ReadTempHum() bool {
+	return s.readTempHum(context.Background()) == nil
+}
+
+////////////////////////////////////////////////////////
+//
+// # Private Functions
+//
+////////////////////////////////////////////////////////
+
+// writeCommandContext writes a command, retrying on transient errors
+func (s *SHT31) writeCommandContext(ctx context.Context, command uint16) error {
+	cmd := []byte{byte(command >> 8), byte(command & 0xFF)}
+	return s.retry.Do(ctx, func() error {
+		_, err := i2c.WriteContext(ctx, s.fd, cmd)
+		return err
+	})
+}
+
+// readTempHum triggers a single shot measurement and reads it back, once
+// done unless the sensor stretches the clock until then
+func (s *SHT31) readTempHum(ctx context.Context) error {
 	readBuffer := make([]byte, 6)
 
-	if _, err := s.WriteCommand(SHT31MeasHighRep); err != nil {
-		// Handle the error (e.g., log it, return it, etc.)
-		return false
+	stretch := 0
+	if s.stretch {
+		stretch = 1
+	}
+	if err := s.writeCommandContext(ctx, singleShotCommands[stretch][s.rep]); err != nil {
+		return err
 	}
 
-	time.Sleep(20 * time.Millisecond)
+	if !s.stretch {
+		if err := sleepContext(ctx, s.rep.Duration()); err != nil {
+			return err
+		}
+	}
 
-	if n, err := s.fd.Read(readBuffer); err != nil || n != len(readBuffer) {
-		// Handle the error or the case where not all bytes were read
-		return false
+	n, err := i2c.ReadContext(ctx, s.fd, readBuffer)
+	if err != nil {
+		return err
+	}
+	return s.decode(readBuffer[:n])
+}
+
+// decode checks and converts a measurement frame
+func (s *SHT31) decode(readBuffer []byte) error {
+	if len(readBuffer) != 6 {
+		return fmt.Errorf("%w: %d bytes out of 6", ErrShortRead, len(readBuffer))
 	}
 
 	if readBuffer[2] != crc8(readBuffer[:2]) || readBuffer[5] != crc8(readBuffer[3:5]) {
-		return false
+		return ErrCRC
 	}
 
 	stemp := int32(uint32(readBuffer[0])<<8 | uint32(readBuffer[1]))
@@ -147,19 +523,36 @@ func (s *SHT31) ReadTempHum() bool {
 	shum = (625 * shum) >> 12
 	s.humidity = float64(shum) / 100.0
 
-	return true
+	return nil
 }
 
-////////////////////////////////////////////////////////
-//
-// # Private Functions
-//
-////////////////////////////////////////////////////////
+// wrapErr tags err with the SHT31 error matching its cause
+func wrapErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, ErrCRC), errors.Is(err, ErrShortRead), errors.Is(err, ErrNACK), errors.Is(err, ErrTimeout), errors.Is(err, ErrNoData):
+		return err
+	case errors.Is(err, regmap.ErrCRC):
+		return fmt.Errorf("%w: %w", ErrCRC, err)
+	case errors.Is(err, syscall.ENXIO), errors.Is(err, syscall.EREMOTEIO):
+		return fmt.Errorf("%w: %w", ErrNACK, err)
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, syscall.ETIMEDOUT):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+	return fmt.Errorf("sht31: %w", err)
+}
 
-// WriteCommand performs an I2C write with the given command
-func (s *SHT31) WriteCommand(command uint16) (int, error) {
-	cmd := []byte{byte(command >> 8), byte(command & 0xFF)}
-	return s.fd.Write(cmd)
+// sleepContext waits for d or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 // crc8 performs a CRC8 calculation on the supplied values
@@ -0,0 +1,248 @@
+package sht31
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"dev/pkg/i2c"
+	"dev/pkg/i2c/sim"
+	"dev/pkg/regmap"
+)
+
+// newSimSensor creates a sensor with opts on a simulated SHT31 measuring
+// 21.5 °C and 48.25 %, its connection going through wrap when not nil
+func newSimSensor(t *testing.T, wrap func(i2c.Conn) i2c.Conn, opts ...Option) (*SHT31, *sim.SHT31) {
+	t.Helper()
+	bus := sim.NewBus()
+	model := sim.NewSHT31(21.5, 48.25)
+	bus.Attach(SHT31DefaultAddr, model)
+	conn, err := bus.Open(SHT31DefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wrap != nil {
+		conn = wrap(conn)
+	}
+	sensor, err := NewSHT31(conn, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sensor, model
+}
+
+func TestReadBoth(t *testing.T) {
+	sensor, model := newSimSensor(t, nil)
+
+	temp, hum, ok := sensor.ReadBoth()
+	if !ok {
+		t.Fatal("ReadBoth failed")
+	}
+	if math.Abs(temp-21.5) > 0.02 || math.Abs(hum-48.25) > 0.02 {
+		t.Errorf("got %.2f °C %.2f %%, want 21.50 °C 48.25 %%", temp, hum)
+	}
+
+	model.Set(-10, 95)
+	if temp := sensor.ReadTemperature(); math.Abs(temp+10) > 0.02 {
+		t.Errorf("got %.2f °C, want -10.00 °C", temp)
+	}
+}
+
+func TestHeater(t *testing.T) {
+	sensor, model := newSimSensor(t, nil)
+
+	if sensor.IsHeaterEnabled() {
+		t.Fatal("heater enabled after power-up")
+	}
+	sensor.Heater(true)
+	if !model.Heater() || !sensor.IsHeaterEnabled() {
+		t.Error("heater not enabled")
+	}
+	sensor.Heater(false)
+	if model.Heater() || sensor.IsHeaterEnabled() {
+		t.Error("heater not disabled")
+	}
+}
+
+func TestReplayCapture(t *testing.T) {
+	f, err := os.Open("testdata/capture.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	replay, err := i2c.NewReplay(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := replay.Open(SHT31DefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sensor, err := NewSHT31(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status := sensor.ReadStatus(); status != 0x8010 {
+		t.Errorf("status %#04x, want 0x8010", status)
+	}
+	for _, want := range [][2]float64{{23.4, 41.7}, {24.1, 39.9}} {
+		temp, hum, ok := sensor.ReadBoth()
+		if !ok {
+			t.Fatal("ReadBoth failed")
+		}
+		if math.Abs(temp-want[0]) > 0.02 || math.Abs(hum-want[1]) > 0.02 {
+			t.Errorf("got %.2f °C %.2f %%, want %.2f °C %.2f %%", temp, hum, want[0], want[1])
+		}
+	}
+	if n := replay.Remaining(); n != 0 {
+		t.Errorf("%d records not replayed", n)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy i2c.FaultPolicy
+		want   error
+	}{
+		{"nack", i2c.FaultPolicy{ErrEvery: 1}, ErrNACK},
+		{"bit flips", i2c.FaultPolicy{Seed: 1, BitFlipRate: 1}, ErrCRC},
+		{"truncated reads", i2c.FaultPolicy{Seed: 1, TruncateRate: 1}, ErrShortRead},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var faulty *i2c.FaultConn
+			sensor, _ := newSimSensor(t, func(conn i2c.Conn) i2c.Conn {
+				faulty = i2c.NewFaultConn(conn, tt.policy)
+				return faulty
+			})
+
+			if _, _, ok := sensor.ReadBoth(); ok {
+				t.Error("ReadBoth succeeded")
+			}
+			if temp := sensor.ReadTemperature(); !math.IsNaN(temp) {
+				t.Errorf("got %.2f °C, want NaN", temp)
+			}
+			if _, _, err := sensor.Measure(); !errors.Is(err, tt.want) {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+			if faulty.Injected() == 0 {
+				t.Error("no fault injected")
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	sensor, _ := newSimSensor(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, _, err := sensor.MeasureContext(ctx); !errors.Is(err, ErrTimeout) {
+		t.Errorf("got %v, want ErrTimeout", err)
+	}
+
+	bus := sim.NewBus()
+	conn, _ := bus.Open(SHT31DefaultAddr)
+	absent, err := NewSHT31(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := absent.Status(); !errors.Is(err, ErrNACK) || !errors.Is(err, syscall.ENXIO) {
+		t.Errorf("got %v, want ErrNACK wrapping ENXIO", err)
+	}
+	if err := absent.SetHeater(true); !errors.Is(err, ErrNACK) {
+		t.Errorf("got %v, want ErrNACK", err)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		command string
+	}{
+		{"default", nil, "2400"},
+		{"medium", []Option{WithRepeatability(RepeatabilityMedium)}, "240b"},
+		{"low stretch", []Option{WithRepeatability(RepeatabilityLow), WithClockStretching(true)}, "2c10"},
+		{"high stretch", []Option{WithClockStretching(true)}, "2c06"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var trace bytes.Buffer
+			sensor, _ := newSimSensor(t, func(conn i2c.Conn) i2c.Conn {
+				return i2c.NewTraceLog(&trace).Wrap(conn, SHT31DefaultAddr)
+			}, tt.opts...)
+
+			if _, _, err := sensor.Measure(); err != nil {
+				t.Fatal(err)
+			}
+			if want := `"write":"` + tt.command + `"`; !strings.Contains(trace.String(), want) {
+				t.Errorf("command %s not sent:\n%s", tt.command, trace.String())
+			}
+		})
+	}
+
+	if _, err := NewSHT31(nil, WithRepeatability(Repeatability(3))); err == nil {
+		t.Error("invalid repeatability accepted")
+	}
+}
+
+func TestReadSerial(t *testing.T) {
+	for _, stretch := range []bool{false, true} {
+		sensor, model := newSimSensor(t, nil, WithClockStretching(stretch))
+		model.SetSerial(0xDEADBEEF)
+		if serial, err := sensor.ReadSerial(); err != nil || serial != 0xDEADBEEF {
+			t.Errorf("stretch %v: got %08x %v, want deadbeef", stretch, serial, err)
+		}
+	}
+
+	sensor, _ := newSimSensor(t, func(conn i2c.Conn) i2c.Conn {
+		return i2c.NewFaultConn(conn, i2c.FaultPolicy{Seed: 1, BitFlipRate: 1})
+	})
+	if _, err := sensor.ReadSerial(); !errors.Is(err, ErrCRC) {
+		t.Errorf("got %v, want ErrCRC", err)
+	}
+}
+
+func TestStatusFields(t *testing.T) {
+	fields := []regmap.Field{statusAlert, statusHeater, statusRHAlert, statusTAlert, statusReset, statusCommand, statusChecksum}
+	for _, f := range fields {
+		if f.Name == "" || f.Width != 1 {
+			t.Errorf("status field %+v not found in the register declaration", f)
+		}
+	}
+}
+
+func TestDecodedStatus(t *testing.T) {
+	sensor, _ := newSimSensor(t, nil)
+
+	status, err := sensor.DecodedStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != (Status{Raw: 0x8010, AlertPending: true, ResetDetected: true}) {
+		t.Errorf("got %+v after power-up", status)
+	}
+	if got, want := status.String(), "0x8010, alert pending, reset detected"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	sensor.SetHeater(true)
+	sensor.ClearStatus()
+	sensor.WriteCommand(0x1234)
+	if status, err := sensor.DecodedStatus(); err != nil || status != (Status{Raw: 0x2002, Heater: true, CommandFailed: true}) {
+		t.Errorf("got %+v %v, want heater on and command failed", status, err)
+	}
+
+	all := Status{0xFFFF, true, true, true, true, true, true, true}
+	if status := ParseStatus(0xFFFF); status != all {
+		t.Errorf("got %+v, want every flag set", status)
+	}
+}
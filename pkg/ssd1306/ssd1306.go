@@ -1,6 +1,7 @@
 package ssd1306
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
@@ -47,9 +48,11 @@ const (
 
 type Display interface {
 	Initialize() error
+	InitializeContext(context.Context) error
 	DisplayOn() (int, error)
 	DisplayOff() (int, error)
 	Display(*screen) error
+	DisplayContext(context.Context, *screen) error
 	Clear(*screen)
 	Draw(*screen)
 	DrawPix(*screen, int, int)
@@ -57,7 +60,7 @@ type Display interface {
 }
 
 type SSD1306_128_64 struct {
-	fd       *i2c.I2CDevice
+	fd       i2c.Conn
 	vccstate bool
 }
 
@@ -83,8 +86,11 @@ func NewScreen(h, w int, vccState bool) *screen {
 	}
 }
 
-func NewDisplay(fd *i2c.I2CDevice, ecran *screen) (Display, error) {
+func NewDisplay(fd i2c.Conn, ecran *screen) (Display, error) {
 	fmt.Println("Init display", ecran.w, ecran.h)
+	if err := i2c.Require(fd, i2c.I2C_FUNC_I2C); err != nil {
+		return nil, fmt.Errorf("ssd1306: %w", err)
+	}
 	switch {
 	case ecran.w == 128 && ecran.h == 32:
 		return nil, fmt.Errorf("unsupported display h=32")
@@ -104,6 +110,11 @@ func NewDisplay(fd *i2c.I2CDevice, ecran *screen) (Display, error) {
 ////////////////////////////////////////////////////////
 
 func (d *SSD1306_128_64) Initialize() error {
+	return d.InitializeContext(context.Background())
+}
+
+// InitializeContext sends the init sequence, giving up when ctx is done
+func (d *SSD1306_128_64) InitializeContext(ctx context.Context) error {
 	fmt.Println("Initialize screen")
 
 	data := []byte{
@@ -160,31 +171,40 @@ func (d *SSD1306_128_64) Initialize() error {
 		SSD1306_NORMALDISPLAY,       // 0xA6
 	}...)
 
-	return sendCommands(*d.fd, data...)
+	return sendCommandsContext(ctx, d.fd, data...)
 }
 
 // Turn on OLED display
 func (d *SSD1306_128_64) DisplayOn() (int, error) {
-	return writeCommand(*d.fd, OLED_CMD_DISPLAY_ON)
+	return writeCommand(d.fd, OLED_CMD_DISPLAY_ON)
 }
 
 // Turn off OLED display
 func (d *SSD1306_128_64) DisplayOff() (int, error) {
-	return writeCommand(*d.fd, OLED_CMD_DISPLAY_OFF)
+	return writeCommand(d.fd, OLED_CMD_DISPLAY_OFF)
 }
 
 // Display buffer to the screen
 func (d *SSD1306_128_64) Display(ecran *screen) error {
-	writeCommand(*d.fd, OLED_CMD_COL_ADDRESSING) //
-	writeCommand(*d.fd, 0)
-	writeCommand(*d.fd, byte(ecran.w-1))
-	writeCommand(*d.fd, OLED_CMD_PAGE_ADDRESSING) //
-	writeCommand(*d.fd, 0)
-	writeCommand(*d.fd, byte((ecran.h/8)-1))
+	return d.DisplayContext(context.Background(), ecran)
+}
+
+// DisplayContext sends the buffer to the screen, giving up when ctx is done.
+// The bus is held for the whole frame when it is shared through a scheduler.
+func (d *SSD1306_128_64) DisplayContext(ctx context.Context, ecran *screen) error {
+	release := i2c.Hold(d.fd)
+	defer release()
+
+	err := sendCommandsContext(ctx, d.fd,
+		OLED_CMD_COL_ADDRESSING, 0, byte(ecran.w-1),
+		OLED_CMD_PAGE_ADDRESSING, 0, byte((ecran.h/8)-1))
+	if err != nil {
+		return err
+	}
 
 	for i := 0; i < len(ecran.buffer); i += 64 {
 		data := ecran.buffer[i : i+64]
-		_, err := writeData(*d.fd, data)
+		_, err := writeDataContext(ctx, d.fd, data)
 		// fmt.Println(data) //check RAM
 		if err != nil {
 			return err
@@ -249,18 +269,18 @@ func (d *SSD1306_128_64) Draw(ecran *screen) {
 // # Private Functions
 //
 // //////////////////////////////////////////////////////
-func newSSD1306_128_64(fd *i2c.I2CDevice, vccstate bool) *SSD1306_128_64 {
+func newSSD1306_128_64(fd i2c.Conn, vccstate bool) *SSD1306_128_64 {
 	return &SSD1306_128_64{
 		fd:       fd,
 		vccstate: vccstate,
 	}
 }
 
-// Send data to OLED
-func writeData(fd i2c.I2CDevice, data []byte) (int, error) {
+// Send data to OLED, giving up when ctx is done
+func writeDataContext(ctx context.Context, fd i2c.Conn, data []byte) (int, error) {
 	res := 0
 	for _, value := range data {
-		if _, err := fd.Write([]byte{OLED_DATA, value}); err != nil {
+		if _, err := i2c.WriteContext(ctx, fd, []byte{OLED_DATA, value}); err != nil {
 			return res, err
 		}
 		res++
@@ -269,14 +289,20 @@ func writeData(fd i2c.I2CDevice, data []byte) (int, error) {
 }
 
 // writeCommand sends a single command byte to the SSD1306 device.
-func writeCommand(fd i2c.I2CDevice, cmd byte) (int, error) {
-	return fd.Write([]byte{SSD1306_CMD, cmd})
+func writeCommand(fd i2c.Conn, cmd byte) (int, error) {
+	return writeCommandContext(context.Background(), fd, cmd)
+}
+
+// writeCommandContext sends a single command byte, giving up when ctx is done
+func writeCommandContext(ctx context.Context, fd i2c.Conn, cmd byte) (int, error) {
+	return i2c.WriteContext(ctx, fd, []byte{SSD1306_CMD, cmd})
 }
 
-// sendCommands sends a sequence of command bytes to the SSD1306 device.
-func sendCommands(fd i2c.I2CDevice, commands ...byte) error {
+// sendCommandsContext sends a sequence of command bytes to the SSD1306 device,
+// giving up when ctx is done
+func sendCommandsContext(ctx context.Context, fd i2c.Conn, commands ...byte) error {
 	for _, cmd := range commands {
-		if _, err := writeCommand(fd, cmd); err != nil {
+		if _, err := writeCommandContext(ctx, fd, cmd); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,51 @@
+package ssd1306
+
+import (
+	"image/color"
+	"testing"
+
+	"dev/pkg/i2c/sim"
+)
+
+func TestDisplay(t *testing.T) {
+	bus := sim.NewBus()
+	model := sim.NewDisplay(sim.SSD1306)
+	bus.Attach(0x3c, model)
+	conn, err := bus.Open(0x3c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecran := NewScreen(64, 128, SSD1306_SWITCHCAPVCC)
+	display, err := NewDisplay(conn, ecran)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := display.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	display.ClearImage(ecran, color.Black)
+	display.DrawPix(ecran, 0, 0)
+	display.DrawPix(ecran, 100, 50)
+	display.Draw(ecran)
+	if err := display.Display(ecran); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := display.DisplayOn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !model.On() {
+		t.Error("display is off")
+	}
+	img := model.Image()
+	for _, p := range [][2]int{{0, 0}, {100, 50}} {
+		if img.GrayAt(p[0], p[1]).Y != 0xFF {
+			t.Errorf("pixel %v is off", p)
+		}
+	}
+	if img.GrayAt(1, 0).Y != 0 {
+		t.Error("pixel (1, 0) is on")
+	}
+}
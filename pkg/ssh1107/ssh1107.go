@@ -1,6 +1,7 @@
 package ssh1107
 
 import (
+	"context"
 	"fmt"
 	"image"
 	"image/color"
@@ -192,11 +193,13 @@ var PROM = []byte{
 
 type Display interface {
 	Initialize() error
+	InitializeContext(context.Context) error
 	GetImage() draw.Image
 	DisplayOn() (int, error)
 	DisplayOff() (int, error)
 	Display() error
 	Display_old() error
+	DisplayContext(context.Context) error
 	//	DisplayDirty(*screen) error
   GetBuffer() []byte
 	Clear()
@@ -209,7 +212,7 @@ type Display interface {
 }
 
 type SSH1107_128_128 struct {
-	fd     *i2c.I2CDevice
+	fd     i2c.Conn
 	screen *screen
 }
 
@@ -250,8 +253,11 @@ func NewScreen(h, w int) *screen {
 	}
 }
 
-func NewDisplay(fd *i2c.I2CDevice, screen *screen) (Display, error) {
+func NewDisplay(fd i2c.Conn, screen *screen) (Display, error) {
 	fmt.Println("Init display", screen.w, screen.h)
+	if err := i2c.Require(fd, i2c.I2C_FUNC_I2C); err != nil {
+		return nil, fmt.Errorf("sh1107: %w", err)
+	}
 	switch {
 	case screen.w == 128 && screen.h == 128:
 		return newSSH1107_128_128(fd, screen), nil
@@ -267,6 +273,11 @@ func NewDisplay(fd *i2c.I2CDevice, screen *screen) (Display, error) {
 ////////////////////////////////////////////////////////
 
 func (d *SSH1107_128_128) Initialize() error {
+	return d.InitializeContext(context.Background())
+}
+
+// InitializeContext sends the init sequence, giving up when ctx is done
+func (d *SSH1107_128_128) InitializeContext(ctx context.Context) error {
 	fmt.Println("Initialize screen")
 
 	data := []byte{
@@ -289,7 +300,7 @@ func (d *SSH1107_128_128) Initialize() error {
 		SH110X_SETDISPLAYOFFSET, 0x00, SH110X_SETMULTIPLEX, 0x7F,
 	}
 
-	return sendCommands(*d.fd, data...)
+	return sendCommandsContext(ctx, d.fd, data...)
 }
 
 func (d *SSH1107_128_128) GetImage() draw.Image {
@@ -307,32 +318,36 @@ func (d *SSH1107_128_128) GetBuffer() []byte{
 
 // Turn on OLED display
 func (d *SSH1107_128_128) DisplayOn() (int, error) {
-	return writeCommand(*d.fd, OLED_CMD_DISPLAY_ON)
+	return writeCommand(d.fd, OLED_CMD_DISPLAY_ON)
 }
 
 // Turn off OLED display
 func (d *SSH1107_128_128) DisplayOff() (int, error) {
-	return writeCommand(*d.fd, OLED_CMD_DISPLAY_OFF)
+	return writeCommand(d.fd, OLED_CMD_DISPLAY_OFF)
 }
 
-// Display buffer to the screen for SH1107
+// Display buffer to the screen for SH1107. The bus is held for the whole
+// frame when it is shared through a scheduler.
 func (d *SSH1107_128_128) Display_old() error {
+	release := i2c.Hold(d.fd)
+	defer release()
+
 	// Start by setting the column address
 	for page := 0; page < d.screen.h/8; page++ {
 		// Set the page address
-		_, err := writeCommand(*d.fd, byte(0xB0|page)) // SH1107 uses 0xB0 to 0xB7 for page addressing
+		_, err := writeCommand(d.fd, byte(0xB0|page)) // SH1107 uses 0xB0 to 0xB7 for page addressing
 		if err != nil {
 			return err
 		}
 
 		// Set the lower column start address
-		_, err = writeCommand(*d.fd, 0x00) // Lower nibble of the column address
+		_, err = writeCommand(d.fd, 0x00) // Lower nibble of the column address
 		if err != nil {
 			return err
 		}
 
 		// Set the higher column start address
-		_, err = writeCommand(*d.fd, 0x10) // Higher nibble of the column address
+		_, err = writeCommand(d.fd, 0x10) // Higher nibble of the column address
 		if err != nil {
 			return err
 		}
@@ -345,7 +360,7 @@ func (d *SSH1107_128_128) Display_old() error {
 		}
 
 		data := d.screen.buffer[start:end]
-		_, err = writeData(*d.fd, data)
+		_, err = writeData(d.fd, data)
 		if err != nil {
 			return err
 		}
@@ -356,6 +371,16 @@ func (d *SSH1107_128_128) Display_old() error {
 
 // Display updates the display buffer to the screen for SH1107
 func (d *SSH1107_128_128) Display() error {
+	return d.DisplayContext(context.Background())
+}
+
+// DisplayContext updates the display buffer to the screen, giving up between
+// two transfers when ctx is done. The bus is held for the whole frame when
+// it is shared through a scheduler.
+func (d *SSH1107_128_128) DisplayContext(ctx context.Context) error {
+	release := i2c.Hold(d.fd)
+	defer release()
+
 	buffer := d.screen.buffer
 	pages := (d.screen.h + 7) / 8 // Total number of pages (rows of 8 pixels)
 	bytesPerPage := d.screen.w    // Width in bytes per page
@@ -377,16 +402,16 @@ func (d *SSH1107_128_128) Display() error {
 
 	for page := firstPage; page < lastPage; page++ {
 		// Set the page address
-		if _, err := writeCommand(*d.fd, byte(0xB0|page)); err != nil {
+		if _, err := writeCommandContext(ctx, d.fd, byte(0xB0|page)); err != nil {
 			return err
 		}
 
 		// Set the higher and lower column start addresses
 		columnStart := pageStart // + d.pageStartOffset // Offset adjustment if required
-		if _, err := writeCommand(*d.fd, byte(0x10|(columnStart>>4))); err != nil {
+		if _, err := writeCommandContext(ctx, d.fd, byte(0x10|(columnStart>>4))); err != nil {
 			return err
 		}
-		if _, err := writeCommand(*d.fd, byte(columnStart&0x0F)); err != nil {
+		if _, err := writeCommandContext(ctx, d.fd, byte(columnStart&0x0F)); err != nil {
 			return err
 		}
 
@@ -398,7 +423,7 @@ func (d *SSH1107_128_128) Display() error {
 		ptr := buffer[page*bytesPerPage+pageStart : page*bytesPerPage+pageStart+bytesRemaining]
 
 		// Write the buffer to the display
-		if _, err := writeData(*d.fd, ptr); err != nil {
+		if _, err := writeDataContext(ctx, d.fd, ptr); err != nil {
 			return err
 		}
 	}
@@ -416,22 +441,22 @@ func (d *SSH1107_128_128) DisplayDirty(d.screen *screen) error {
 
 	for page := firstPage; page <= lastPage; page++ {
 		// Set the page address
-		if _, err := writeCommand(*d.fd, byte(0xB0|page)); err != nil {
+		if _, err := writeCommand(d.fd, byte(0xB0|page)); err != nil {
 			return err
 		}
 
 		// Set the column start and end addresses
-		if _, err := writeCommand(*d.fd, byte(0x10|(startColumn>>4))); err != nil {
+		if _, err := writeCommand(d.fd, byte(0x10|(startColumn>>4))); err != nil {
 			qeturn err
 		}
-		if _, err := writeCommand(*d.fd, byte(startColumn&0x0F)); err != nil {
+		if _, err := writeCommand(d.fd, byte(startColumn&0x0F)); err != nil {
 			return err
 		}
 
 		// Write the dirty portion of this page
 		startIndex := page*d.screen.w + startColumn
 		endIndex := page*d.screen.w + endColumn + 1
-		if _, err := writeData(*d.fd, d.screen.buffer[startIndex:endIndex]); err != nil {
+		if _, err := writeData(d.fd, d.screen.buffer[startIndex:endIndex]); err != nil {
 			return err
 		}
 	}
@@ -609,7 +634,7 @@ func (d *SSH1107_128_128) Draw() {
 // # Private Functions
 //
 // //////////////////////////////////////////////////////
-func newSSH1107_128_128(fd *i2c.I2CDevice, screen *screen) *SSH1107_128_128 {
+func newSSH1107_128_128(fd i2c.Conn, screen *screen) *SSH1107_128_128 {
 	return &SSH1107_128_128{
 		fd:     fd,
 		screen: screen,
@@ -617,10 +642,16 @@ func newSSH1107_128_128(fd *i2c.I2CDevice, screen *screen) *SSH1107_128_128 {
 }
 
 // Send data to OLED
-func writeData(fd i2c.I2CDevice, data []byte) (int, error) {
+func writeData(fd i2c.Conn, data []byte) (int, error) {
+	return writeDataContext(context.Background(), fd, data)
+}
+
+// writeDataContext sends data to the OLED, giving up between two bytes when
+// ctx is done
+func writeDataContext(ctx context.Context, fd i2c.Conn, data []byte) (int, error) {
 	res := 0
 	for _, value := range data {
-		if _, err := fd.Write([]byte{OLED_DATA, value}); err != nil {
+		if _, err := i2c.WriteContext(ctx, fd, []byte{OLED_DATA, value}); err != nil {
 			return res, err
 		}
 		res++
@@ -629,14 +660,20 @@ func writeData(fd i2c.I2CDevice, data []byte) (int, error) {
 }
 
 // writeCommand sends a single command byte to the SSH1107 device
-func writeCommand(fd i2c.I2CDevice, cmd byte) (int, error) {
-	return fd.Write([]byte{OLED_CMD, cmd})
+func writeCommand(fd i2c.Conn, cmd byte) (int, error) {
+	return writeCommandContext(context.Background(), fd, cmd)
+}
+
+// writeCommandContext sends a single command byte, giving up when ctx is done
+func writeCommandContext(ctx context.Context, fd i2c.Conn, cmd byte) (int, error) {
+	return i2c.WriteContext(ctx, fd, []byte{OLED_CMD, cmd})
 }
 
-// sendCommands sends a sequence of command bytes to the SSH1107 device.
-func sendCommands(fd i2c.I2CDevice, commands ...byte) error {
+// sendCommandsContext sends a sequence of command bytes to the SSH1107 device,
+// giving up when ctx is done
+func sendCommandsContext(ctx context.Context, fd i2c.Conn, commands ...byte) error {
 	for _, cmd := range commands {
-		if _, err := writeCommand(fd, cmd); err != nil {
+		if _, err := writeCommandContext(ctx, fd, cmd); err != nil {
 			return err
 		}
 	}
@@ -0,0 +1,112 @@
+package ssh1107
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/color"
+	"syscall"
+	"testing"
+	"time"
+
+	"dev/pkg/i2c"
+	"dev/pkg/i2c/sim"
+)
+
+func newSimDisplay(t *testing.T) (Display, *sim.Display) {
+	t.Helper()
+	bus := sim.NewBus()
+	model := sim.NewDisplay(sim.SH1107)
+	bus.Attach(0x3c, model)
+	conn, err := bus.Open(0x3c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	display, err := NewDisplay(conn, NewScreen(128, 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := display.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return display, model
+}
+
+func TestDisplayLogo(t *testing.T) {
+	display, model := newSimDisplay(t)
+
+	display.DrawImg()
+	if err := display.Display_old(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := display.DisplayOn(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !model.On() {
+		t.Error("display is off")
+	}
+	if !bytes.Equal(model.GDDRAM(), PROM) {
+		t.Error("GDDRAM does not hold the logo")
+	}
+}
+
+func TestDisplayImage(t *testing.T) {
+	display, model := newSimDisplay(t)
+
+	display.ClearImage(color.Black)
+	display.DrawPix(5, 10)
+	display.DrawPix(127, 127)
+	display.Draw()
+	if err := display.Display(); err != nil {
+		t.Fatal(err)
+	}
+
+	img := model.Image()
+	for _, p := range [][2]int{{5, 10}, {127, 127}} {
+		if img.GrayAt(p[0], p[1]).Y != 0xFF {
+			t.Errorf("pixel %v is off", p)
+		}
+	}
+	if img.GrayAt(6, 10).Y != 0 {
+		t.Error("pixel (6, 10) is on")
+	}
+}
+
+func TestDisplayFaults(t *testing.T) {
+	bus := sim.NewBus()
+	bus.Attach(0x3c, sim.NewDisplay(sim.SH1107))
+	conn, _ := bus.Open(0x3c)
+	faulty := i2c.NewFaultConn(conn, i2c.FaultPolicy{ErrEvery: 100, Delay: time.Microsecond})
+	display, err := NewDisplay(faulty, NewScreen(128, 128))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	display.DrawImg()
+	if err := display.Display_old(); !errors.Is(err, syscall.ENXIO) {
+		t.Errorf("got %v, want ENXIO", err)
+	}
+}
+
+func TestDisplayContext(t *testing.T) {
+	display, model := newSimDisplay(t)
+
+	display.DrawImg()
+	if err := display.DisplayContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(model.GDDRAM(), PROM) {
+		t.Error("GDDRAM does not hold the logo")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	display.Clear()
+	if err := display.DisplayContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v, want Canceled", err)
+	}
+	if !bytes.Equal(model.GDDRAM(), PROM) {
+		t.Error("GDDRAM written after the context was cancelled")
+	}
+}
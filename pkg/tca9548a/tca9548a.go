@@ -0,0 +1,184 @@
+package tca9548a
+
+import (
+	"fmt"
+	"sync"
+
+	"dev/pkg/i2c"
+)
+
+const (
+	TCA9548ADefaultAddr = 0x70 // TCA9548A Default Address, up to 0x77 with A0-A2
+	TCA9548AChannels    = 8    // Number of downstream channels
+	TCA9548ANoChannel   = 0x00 // Control register value disconnecting all channels
+)
+
+// Mux is a TCA9548A multiplexer. Each of its channels is a bus of its own,
+// so that devices sharing an address can sit on different channels. The
+// channel is switched before each transfer when needed, and stays selected
+// until a device of another channel is accessed.
+type Mux struct {
+	conn i2c.Conn
+	bus  i2c.Bus
+	addr uint16
+
+	mu      sync.Mutex
+	current int // Selected channel, -1 when unknown or none
+}
+
+// Channel is a downstream bus of the multiplexer
+type Channel struct {
+	mux   *Mux
+	n     int
+	scope string // Scope of the devices within the channel, such as a mux behind it
+}
+
+var _ i2c.ScopedBus = (*Channel)(nil)
+
+/////////////////////////////////////////////////////////
+//
+// # Declaration Functions
+//
+////////////////////////////////////////////////////////
+
+// NewMux creates the multiplexer at addr on bus and disconnects all its
+// channels, so that its state is known
+func NewMux(bus i2c.Bus, addr uint16) (*Mux, error) {
+	conn, err := bus.Open(addr)
+	if err != nil {
+		return nil, err
+	}
+	m := &Mux{conn: conn, bus: bus, addr: addr, current: -1}
+	if err := m.Disable(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return m, nil
+}
+
+/////////////////////////////////////////////////////////
+//
+// # Interface Functions
+//
+////////////////////////////////////////////////////////
+
+// Channel returns the downstream bus of channel n
+func (m *Mux) Channel(n int) (*Channel, error) {
+	if n < 0 || n >= TCA9548AChannels {
+		return nil, fmt.Errorf("tca9548a: invalid channel %d", n)
+	}
+	return &Channel{mux: m, n: n}, nil
+}
+
+// Disable disconnects all the channels
+func (m *Mux) Disable() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = -1
+	if _, err := m.conn.Write([]byte{TCA9548ANoChannel}); err != nil {
+		return fmt.Errorf("tca9548a: %w", err)
+	}
+	return nil
+}
+
+// Invalidate forgets the selected channel, e.g. after the multiplexer was
+// reset, so that the next transfer selects it again
+func (m *Mux) Invalidate() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current = -1
+}
+
+// Close disconnects all the channels and closes the multiplexer
+func (m *Mux) Close() error {
+	err := m.Disable()
+	if cerr := m.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Open returns a connection to addr on the channel. On a bus locking its
+// devices, such as an i2c.Adapter, the device is locked in the scope of the
+// channel, apart from the devices at addr on the other channels.
+func (c *Channel) Open(addr uint16) (i2c.Conn, error) {
+	scope := fmt.Sprintf("%#02x.%d", c.mux.addr, c.n)
+	if c.scope != "" {
+		scope += "-" + c.scope
+	}
+	conn, err := i2c.Scope(c.mux.bus, scope).Open(addr)
+	if err != nil {
+		return nil, err
+	}
+	return &channelConn{conn: conn, mux: c.mux, n: c.n}, nil
+}
+
+// Scope returns the channel with its devices in scope name, nested within
+// the scope of the channel, so that the channels of a mux behind this one
+// are locked apart
+func (c *Channel) Scope(name string) i2c.Bus {
+	if c.scope != "" {
+		name = c.scope + "-" + name
+	}
+	return &Channel{mux: c.mux, n: c.n, scope: name}
+}
+
+////////////////////////////////////////////////////////
+//
+// # Private Functions
+//
+////////////////////////////////////////////////////////
+
+// do runs op with channel n selected, the multiplexer being held meanwhile
+// so that no other channel gets selected in the middle of a transfer
+func (m *Mux) do(n int, op func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.current != n {
+		if _, err := m.conn.Write([]byte{1 << n}); err != nil {
+			m.current = -1
+			return fmt.Errorf("tca9548a: select channel %d: %w", n, err)
+		}
+		m.current = n
+	}
+	return op()
+}
+
+// channelConn is a connection to a device behind the multiplexer
+type channelConn struct {
+	conn i2c.Conn
+	mux  *Mux
+	n    int
+}
+
+func (c *channelConn) Read(buf []byte) (int, error) {
+	var n int
+	err := c.mux.do(c.n, func() (err error) {
+		n, err = c.conn.Read(buf)
+		return err
+	})
+	return n, err
+}
+
+func (c *channelConn) Write(buf []byte) (int, error) {
+	var n int
+	err := c.mux.do(c.n, func() (err error) {
+		n, err = c.conn.Write(buf)
+		return err
+	})
+	return n, err
+}
+
+func (c *channelConn) Tx(w, r []byte) error {
+	return c.mux.do(c.n, func() error {
+		return c.conn.Tx(w, r)
+	})
+}
+
+func (c *channelConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *channelConn) Capabilities() (i2c.Capabilities, error) {
+	return i2c.CapabilitiesOf(c.conn)
+}
@@ -0,0 +1,156 @@
+package tca9548a
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"syscall"
+	"testing"
+
+	"dev/pkg/i2c"
+	"dev/pkg/i2c/sim"
+	"dev/pkg/sht31"
+)
+
+func TestChannels(t *testing.T) {
+	bus := sim.NewBus()
+	model := sim.NewTCA9548A()
+	bus.Attach(TCA9548ADefaultAddr, model)
+	model.Channel(0).Attach(sht31.SHT31DefaultAddr, sim.NewSHT31(21.5, 48.25))
+	model.Channel(5).Attach(sht31.SHT31DefaultAddr, sim.NewSHT31(-4, 80))
+
+	mux, err := NewMux(bus, TCA9548ADefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+
+	var sensors []*sht31.SHT31
+	for _, n := range []int{0, 5} {
+		ch, err := mux.Channel(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := ch.Open(sht31.SHT31DefaultAddr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sensor, err := sht31.NewSHT31(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sensors = append(sensors, sensor)
+	}
+
+	for i, want := range []float64{21.5, -4} {
+		if temp := sensors[i].ReadTemperature(); math.Abs(temp-want) > 0.02 {
+			t.Errorf("sensor %d: got %.2f °C, want %.2f °C", i, temp, want)
+		}
+	}
+	if got := model.Control(); got != 1<<5 {
+		t.Errorf("got control %#02x, want channel 5 selected", got)
+	}
+
+	// The selected channel is cached: no switch between reads of the same sensor
+	switches := model.Switches()
+	sensors[1].ReadTemperature()
+	sensors[1].ReadHumidity()
+	if got := model.Switches(); got != switches {
+		t.Errorf("got %d channel switches, want none", got-switches)
+	}
+	sensors[0].ReadTemperature()
+	if got := model.Switches(); got != switches+1 {
+		t.Errorf("got %d channel switches, want 1", got-switches)
+	}
+
+	if _, err := mux.Channel(8); err == nil {
+		t.Error("channel 8 accepted")
+	}
+}
+
+// lockingBus is a sim.Bus locking its devices like an i2c.Adapter does, one
+// lock per scope and address
+type lockingBus struct {
+	*sim.Bus
+	scope string
+	held  map[string]bool
+}
+
+func (b *lockingBus) Open(addr uint16) (i2c.Conn, error) {
+	key := fmt.Sprintf("%s/%#02x", b.scope, addr)
+	if b.held[key] {
+		return nil, &i2c.LockError{Path: key}
+	}
+	conn, err := b.Bus.Open(addr)
+	if err != nil {
+		return nil, err
+	}
+	b.held[key] = true
+	return conn, nil
+}
+
+func (b *lockingBus) Scope(name string) i2c.Bus {
+	return &lockingBus{Bus: b.Bus, scope: b.scope + "-" + name, held: b.held}
+}
+
+func TestChannelsLocked(t *testing.T) {
+	bus := &lockingBus{Bus: sim.NewBus(), held: make(map[string]bool)}
+	model := sim.NewTCA9548A()
+	bus.Attach(TCA9548ADefaultAddr, model)
+	model.Channel(1).Attach(sht31.SHT31DefaultAddr, sim.NewSHT31(10, 30))
+	model.Channel(2).Attach(sht31.SHT31DefaultAddr, sim.NewSHT31(20, 40))
+
+	mux, err := NewMux(bus, TCA9548ADefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+
+	for _, n := range []int{1, 2} {
+		ch, _ := mux.Channel(n)
+		if _, err := ch.Open(sht31.SHT31DefaultAddr); err != nil {
+			t.Fatalf("channel %d: %v", n, err)
+		}
+	}
+	ch, _ := mux.Channel(1)
+	if _, err := ch.Open(sht31.SHT31DefaultAddr); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("got %v opening a device twice, want EBUSY", err)
+	}
+}
+
+func TestNestedChannelsLocked(t *testing.T) {
+	bus := &lockingBus{Bus: sim.NewBus(), held: make(map[string]bool)}
+	outerModel, innerModel := sim.NewTCA9548A(), sim.NewTCA9548A()
+	bus.Attach(TCA9548ADefaultAddr, outerModel)
+	outerModel.Channel(5).Attach(TCA9548ADefaultAddr+1, innerModel)
+	innerModel.Channel(1).Attach(sht31.SHT31DefaultAddr, sim.NewSHT31(10, 30))
+	innerModel.Channel(2).Attach(sht31.SHT31DefaultAddr, sim.NewSHT31(20, 40))
+
+	outer, err := NewMux(bus, TCA9548ADefaultAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outer.Close()
+	ch, _ := outer.Channel(5)
+	inner, err := NewMux(ch, TCA9548ADefaultAddr+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer inner.Close()
+
+	for _, n := range []int{1, 2} {
+		ch, _ := inner.Channel(n)
+		if _, err := ch.Open(sht31.SHT31DefaultAddr); err != nil {
+			t.Fatalf("channel %d: %v", n, err)
+		}
+	}
+	for _, key := range []string{"-0x70.5/0x71", "-0x70.5-0x71.1/0x44", "-0x70.5-0x71.2/0x44"} {
+		if !bus.held[key] {
+			t.Errorf("%s not locked, got %v", key, bus.held)
+		}
+	}
+	ch, _ = inner.Channel(2)
+	if _, err := ch.Open(sht31.SHT31DefaultAddr); !errors.Is(err, syscall.EBUSY) {
+		t.Errorf("got %v opening a device twice, want EBUSY", err)
+	}
+}